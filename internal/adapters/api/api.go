@@ -2,11 +2,18 @@ package api
 
 import (
 	"context"
+	"errors"
 	"gps/internal/adapters/api/middleware"
+	"gps/internal/domain/models"
 	"gps/pkg/ws"
 	"net/http"
 )
 
+var (
+	ErrNoAuthMiddleware  = errors.New("api: auth middleware is required")
+	ErrNoRouteAuthorizer = errors.New("api: route authorizer is required")
+)
+
 type Api struct {
 	websocketManager *ws.Manager
 	authMiddleware   middleware.Middleware
@@ -14,6 +21,28 @@ type Api struct {
 	server           *http.Server
 }
 
+// New builds the HTTP API listening on addr. authMiddleware guards every
+// non-public route and the handler must carry a route authorizer (see
+// WithSharing); without either New refuses to build the server rather
+// than serve routes unauthenticated or without ownership checks.
+func New(addr string, h *handler, authMiddleware middleware.Middleware) (*Api, error) {
+	if h == nil {
+		return nil, errors.New("api: handler is required")
+	}
+	if authMiddleware == nil {
+		return nil, ErrNoAuthMiddleware
+	}
+	if h.routeAuth == nil {
+		return nil, ErrNoRouteAuthorizer
+	}
+	return &Api{
+		websocketManager: h.ws,
+		authMiddleware:   authMiddleware,
+		handler:          h,
+		server:           &http.Server{Addr: addr},
+	}, nil
+}
+
 func (a *Api) Start() error {
 	mux := http.NewServeMux()
 
@@ -21,11 +50,72 @@ func (a *Api) Start() error {
 	mux.Handle("POST /login", middleware.LoggingMiddleware(a.handler.login))
 	mux.Handle("GET /ws/location/{route_id}", middleware.LoggingMiddleware(a.handler.websocket))
 	mux.Handle("GET /ws/aggregation/{route_id}", middleware.LoggingMiddleware(a.handler.websocket))
+	mux.Handle("POST /ingest", middleware.LoggingMiddleware(a.handler.ingest))
+
+	mux.Handle("POST /token/refresh", middleware.LoggingMiddleware(a.handler.refreshToken))
+	mux.Handle("POST /logout", middleware.LoggingMiddleware(a.handler.logout))
+	mux.Handle("GET /auth/validate", middleware.LoggingMiddleware(a.handler.validateToken))
+	mux.Handle("GET /.well-known/jwks.json", middleware.LoggingMiddleware(a.handler.jwks))
+	mux.Handle("PUT /users/{user_id}/roles", a.guarded(models.PermUsersManage, a.handler.setUserRoles))
+
+	mux.Handle("POST /geofences", a.guarded(models.PermGeofencesManage, a.handler.createGeofence))
+	mux.Handle("GET /geofences", a.guarded(models.PermFleetRead, a.handler.listGeofences))
+	mux.Handle("DELETE /geofences/{fence_id}", a.guarded(models.PermGeofencesManage, a.handler.deleteGeofence))
+	mux.Handle("GET /geofences/{fence_id}/events", a.guarded(models.PermFleetRead, a.handler.geofenceEvents))
+	mux.Handle("GET /ws/geofence/{fence_id}", middleware.LoggingMiddleware(a.handler.geofenceWebsocket))
+
+	mux.Handle("GET /rollups", a.guarded(models.PermFleetRead, a.handler.queryRollups))
+
+	mux.Handle("POST /routes", a.guarded(models.PermRoutesWrite, a.handler.createRoute))
+	mux.Handle("GET /routes", a.guarded(models.PermRoutesRead, a.handler.listRoutes))
+	mux.Handle("GET /routes/{route_id}/points", a.guarded(models.PermRoutesRead, a.handler.routePoints))
+	mux.Handle("GET /routes/{route_id}/export", a.guarded(models.PermRoutesRead, a.handler.exportRoute))
+	mux.Handle("GET /routes/{route_id}/smoothed", a.guarded(models.PermRoutesRead, a.handler.smoothedRoute))
+	mux.Handle("POST /routes/{route_id}/shares", a.guarded(models.PermRoutesRead, a.handler.shareRoute))
+	mux.Handle("GET /routes/{route_id}/shares", a.guarded(models.PermRoutesRead, a.handler.listShares))
+	mux.Handle("DELETE /routes/{route_id}/shares/{user_id}", a.guarded(models.PermRoutesRead, a.handler.unshareRoute))
+	mux.Handle("POST /routes/{route_id}/links", a.guarded(models.PermRoutesRead, a.handler.createShareLink))
+	mux.Handle("GET /routes/{route_id}/links", a.guarded(models.PermRoutesRead, a.handler.listShareLinks))
+	mux.Handle("DELETE /routes/{route_id}/links/{link_id}", a.guarded(models.PermRoutesRead, a.handler.revokeShareLink))
+	mux.Handle("GET /shared/{token}/points", middleware.LoggingMiddleware(a.handler.sharedPoints))
+	mux.Handle("GET /shared/{token}/export", middleware.LoggingMiddleware(a.handler.sharedExport))
+
+	mux.Handle("POST /devices", a.guarded(models.PermExchangersManage, a.handler.registerDevice))
+	mux.Handle("GET /devices", a.guarded(models.PermExchangersManage, a.handler.listDevices))
+	mux.Handle("GET /devices/{device_id}", a.guarded(models.PermExchangersManage, a.handler.getDevice))
+	mux.Handle("PUT /devices/{device_id}", a.guarded(models.PermExchangersManage, a.handler.updateDevice))
+	mux.Handle("DELETE /devices/{device_id}", a.guarded(models.PermExchangersManage, a.handler.deleteDevice))
+	mux.Handle("POST /devices/{device_id}/key", a.guarded(models.PermExchangersManage, a.handler.rotateDeviceKey))
+
+	if a.handler.ws != nil {
+		go a.handler.commands().Run(context.Background(), a.handler.ws.ReadChannel())
+	}
 
 	a.server.Handler = mux
 	return a.server.ListenAndServe()
 }
 
+// protected requires an authenticated identity. An Api built without New
+// has no auth middleware and answers 401 instead of letting requests in.
+func (a *Api) protected(next http.HandlerFunc) http.HandlerFunc {
+	if a.authMiddleware == nil {
+		return middleware.LoggingMiddleware(unauthenticated)
+	}
+	return middleware.CreateMiddlewareChain(middleware.LoggingMiddleware, a.authMiddleware)(next)
+}
+
+// guarded is protected plus a permission check.
+func (a *Api) guarded(perm models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	if a.authMiddleware == nil {
+		return a.protected(next)
+	}
+	return middleware.CreateMiddlewareChain(middleware.LoggingMiddleware, a.authMiddleware, middleware.RequirePermission(perm))(next)
+}
+
+func unauthenticated(w http.ResponseWriter, _ *http.Request) {
+	writeError(w, http.StatusUnauthorized, "authentication is not configured")
+}
+
 func (a *Api) StopServer(ctx context.Context) error {
 	return a.server.Shutdown(ctx)
 }
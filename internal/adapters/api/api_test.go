@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNewRequiresAuthMiddleware(t *testing.T) {
+	if _, err := New(":0", NewHandler(nil, nil, nil), nil); !errors.Is(err, ErrNoAuthMiddleware) {
+		t.Fatalf("expected ErrNoAuthMiddleware, got %v", err)
+	}
+}
+
+func TestGuardedFailsClosedWithoutAuth(t *testing.T) {
+	a := &Api{handler: NewHandler(nil, nil, nil)}
+	called := false
+	h := a.guarded(models.PermRoutesRead, func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	if called || rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without calling the handler, got %d (called=%v)", rec.Code, called)
+	}
+}
+
+func TestNewRequiresRouteAuthorizer(t *testing.T) {
+	mw := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if _, err := New(":0", NewHandler(nil, nil, nil), mw); !errors.Is(err, ErrNoRouteAuthorizer) {
+		t.Fatalf("expected ErrNoRouteAuthorizer, got %v", err)
+	}
+}
+
+func TestRouteReadFailsClosedWithoutAuthorizer(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	req := httptest.NewRequest(http.MethodGet, "/routes/"+uuid.NewString()+"/points", nil)
+	req.SetPathValue("route_id", uuid.NewString())
+
+	rec := httptest.NewRecorder()
+	if _, ok := h.authorizeRouteRead(rec, req); ok || rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d (ok=%v)", rec.Code, ok)
+	}
+}
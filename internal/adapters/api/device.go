@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"gps/internal/app_services/device"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type DeviceService interface {
+	Register(ctx context.Context, input device.Input) (string, models.Device, error)
+	Get(ctx context.Context, deviceID uuid.UUID) (models.Device, error)
+	List(ctx context.Context) ([]models.Device, error)
+	Update(ctx context.Context, deviceID uuid.UUID, input device.Input) (models.Device, error)
+	RotateKey(ctx context.Context, deviceID uuid.UUID) (string, error)
+	Delete(ctx context.Context, deviceID uuid.UUID) error
+}
+
+func WithDevices(svc DeviceService) HandlerOption {
+	return func(h *handler) {
+		h.devices = svc
+	}
+}
+
+type deviceKeyResponse struct {
+	models.Device
+	APIKey string `json:"api_key"`
+}
+
+// deviceRequest parses the device id for the per-device admin endpoints.
+// It writes the error response itself and returns false on failure.
+func (h *handler) deviceRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if h.devices == nil {
+		writeError(w, http.StatusNotImplemented, "device registry not configured")
+		return uuid.Nil, false
+	}
+	deviceID, err := parseUUIDParam(r, "device_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return uuid.Nil, false
+	}
+	return deviceID, true
+}
+
+func (h *handler) registerDevice(w http.ResponseWriter, r *http.Request) {
+	if h.devices == nil {
+		writeError(w, http.StatusNotImplemented, "device registry not configured")
+		return
+	}
+	var input device.Input
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key, registered, err := h.devices.Register(r.Context(), input)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, deviceKeyResponse{Device: registered, APIKey: key})
+}
+
+func (h *handler) listDevices(w http.ResponseWriter, r *http.Request) {
+	if h.devices == nil {
+		writeError(w, http.StatusNotImplemented, "device registry not configured")
+		return
+	}
+	devices, err := h.devices.List(r.Context())
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (h *handler) getDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceRequest(w, r)
+	if !ok {
+		return
+	}
+	found, err := h.devices.Get(r.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+func (h *handler) updateDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceRequest(w, r)
+	if !ok {
+		return
+	}
+	var input device.Input
+	if err := decodeJSON(r, &input); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	updated, err := h.devices.Update(r.Context(), deviceID, input)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// rotateDeviceKey serves POST /devices/{device_id}/key. The previous key
+// stops working immediately.
+func (h *handler) rotateDeviceKey(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceRequest(w, r)
+	if !ok {
+		return
+	}
+	key, err := h.devices.RotateKey(r.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"api_key": key})
+}
+
+func (h *handler) deleteDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := h.deviceRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.devices.Delete(r.Context(), deviceID); err != nil {
+		writeDeviceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeDeviceError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrDeviceNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrDuplicateDevice):
+		status = http.StatusConflict
+	case errors.Is(err, device.ErrInvalidDevice):
+		status = http.StatusBadRequest
+	}
+	writeError(w, status, err.Error())
+}
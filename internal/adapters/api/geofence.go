@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gps/internal/app_services/geofence"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type GeofenceService interface {
+	CreateFence(ctx context.Context, fence models.Geofence) (models.Geofence, error)
+	ListFences(ctx context.Context) ([]models.Geofence, error)
+	DeleteFence(ctx context.Context, fenceID uuid.UUID) error
+	Events(ctx context.Context, fenceID uuid.UUID, limit int) ([]models.GeofenceEvent, error)
+}
+
+func WithGeofences(svc GeofenceService) HandlerOption {
+	return func(h *handler) {
+		h.geofences = svc
+	}
+}
+
+func (h *handler) createGeofence(w http.ResponseWriter, r *http.Request) {
+	if h.geofences == nil {
+		writeError(w, http.StatusNotImplemented, "geofence service not configured")
+		return
+	}
+	var fence models.Geofence
+	if err := decodeJSON(r, &fence); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.geofences.CreateFence(r.Context(), fence)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, geofence.ErrInvalidGeofence) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *handler) listGeofences(w http.ResponseWriter, r *http.Request) {
+	if h.geofences == nil {
+		writeError(w, http.StatusNotImplemented, "geofence service not configured")
+		return
+	}
+	fences, err := h.geofences.ListFences(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, fences)
+}
+
+func (h *handler) deleteGeofence(w http.ResponseWriter, r *http.Request) {
+	if h.geofences == nil {
+		writeError(w, http.StatusNotImplemented, "geofence service not configured")
+		return
+	}
+	fenceID, err := parseUUIDParam(r, "fence_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.geofences.DeleteFence(r.Context(), fenceID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) geofenceEvents(w http.ResponseWriter, r *http.Request) {
+	if h.geofences == nil {
+		writeError(w, http.StatusNotImplemented, "geofence service not configured")
+		return
+	}
+	fenceID, err := parseUUIDParam(r, "fence_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	events, err := h.geofences.Events(r.Context(), fenceID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (h *handler) geofenceWebsocket(w http.ResponseWriter, r *http.Request) {
+	h.serveWS(w, r, "fence_id", models.PermFleetRead)
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
+	"gps/internal/adapters/api/middleware"
 	"gps/internal/app_services/auth"
 	"gps/internal/domain/models"
 	"gps/internal/domain/services"
@@ -18,26 +20,47 @@ type handler struct {
 	ws         *ws.Manager
 	auth       AuthService
 	aggregator Aggregator
+	geofences  GeofenceService
+	rollups    RollupService
+	routes     RouteService
+	routeAuth  RouteAuthorizer
+	sharing    SharingService
+	devices    DeviceService
+
+	ingestDevices DeviceAuthenticator
+	ingestSink    PointSink
+	idempotency   IdempotencyStore
 }
 
+type HandlerOption func(*handler)
+
 type AuthService interface {
-	SignUp(ctx context.Context, input auth.Input) (string, error)
-	LogIn(ctx context.Context, input auth.Input) (string, error)
+	SignUp(ctx context.Context, input auth.Input) (auth.Tokens, error)
+	LogIn(ctx context.Context, input auth.Input) (auth.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (auth.Tokens, error)
+	Logout(ctx context.Context, claims auth.JWTClaims, refreshToken string) error
+	ValidateToken(ctx context.Context, token string) (auth.JWTClaims, error)
+	SetRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) (models.User, error)
+	JWKS() auth.JWKS
 }
 
 type Aggregator interface {
 	AggregateRoute(route models.Route) models.AggregatedData
 }
 
-func NewHandler(wsManager *ws.Manager, authService AuthService, aggregator Aggregator) *handler {
+func NewHandler(wsManager *ws.Manager, authService AuthService, aggregator Aggregator, opts ...HandlerOption) *handler {
 	if aggregator == nil {
 		aggregator = services.NewAggregator()
 	}
-	return &handler{
+	h := &handler{
 		ws:         wsManager,
 		auth:       authService,
 		aggregator: aggregator,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *handler) signUp(w http.ResponseWriter, r *http.Request) {
@@ -51,13 +74,17 @@ func (h *handler) signUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.auth.SignUp(r.Context(), input)
+	tokens, err := h.auth.SignUp(r.Context(), input)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		status := http.StatusBadRequest
+		if errors.Is(err, auth.ErrUsernameTaken) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]string{"token": token})
+	writeJSON(w, http.StatusCreated, tokens)
 }
 
 func (h *handler) login(w http.ResponseWriter, r *http.Request) {
@@ -71,7 +98,7 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.auth.LogIn(r.Context(), input)
+	tokens, err := h.auth.LogIn(r.Context(), input)
 	if err != nil {
 		status := http.StatusUnauthorized
 		if errors.Is(err, auth.ErrUserNotFound) {
@@ -81,46 +108,209 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"token": token})
+	writeJSON(w, http.StatusOK, tokens)
 }
 
-// func (h *handler) createRoute(w http.ResponseWriter, r *http.Request) {
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
 
-// 	var route models.Route
-// 	if err := decodeJSON(r, &route); err != nil {
-// 		writeError(w, http.StatusBadRequest, err.Error())
-// 		return
-// 	}
+// refreshToken serves POST /token/refresh, rotating the refresh token.
+func (h *handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return
+	}
+	var body refreshRequest
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tokens, err := h.auth.Refresh(r.Context(), body.RefreshToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			status = http.StatusUnauthorized
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
 
-// 	if route.RouteID == uuid.Nil {
-// 		route.RouteID = uuid.New()
-// 	}
-// 	if route.StartTime.IsZero() && len(route.Path) > 0 {
-// 		route.StartTime = route.Path[0].Timestamp
-// 	}
-// 	if route.EndTime.IsZero() && len(route.Path) > 0 {
-// 		route.EndTime = route.Path[len(route.Path)-1].Timestamp
-// 	}
+// logout serves POST /logout. The bearer access token is revoked, and the
+// refresh token family too when one is sent in the body.
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return
+	}
+	claims, ok := h.bearerClaims(w, r)
+	if !ok {
+		return
+	}
+	var body refreshRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := h.auth.Logout(r.Context(), claims, body.RefreshToken); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-// 	if err := h.routes.StoreRoute(r.Context(), route); err != nil {
-// 		writeError(w, http.StatusInternalServerError, err.Error())
-// 		return
-// 	}
+// bearerClaims validates the Authorization bearer token. It writes the
+// error response itself and returns false on failure.
+func (h *handler) bearerClaims(w http.ResponseWriter, r *http.Request) (auth.JWTClaims, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, "missing token")
+		return auth.JWTClaims{}, false
+	}
+	claims, err := h.auth.ValidateToken(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return auth.JWTClaims{}, false
+	}
+	return claims, true
+}
+
+// jwks publishes the public token verification keys. It is unauthenticated
+// so other services can fetch it before they hold a token.
+func (h *handler) jwks(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.auth.JWKS())
+}
 
-// 	writeJSON(w, http.StatusCreated, map[string]string{"route_id": route.RouteID.String()})
-// }
+// validateToken serves GET /auth/validate for BaseAuthClient: it returns
+// the identity and claims carried by the bearer token.
+func (h *handler) validateToken(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return
+	}
+	claims, ok := h.bearerClaims(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, middleware.IdentityFromClaims(claims))
+}
 
+type rolesRequest struct {
+	Roles       []models.Role       `json:"roles"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// setUserRoles serves PUT /users/{user_id}/roles.
+func (h *handler) setUserRoles(w http.ResponseWriter, r *http.Request) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return
+	}
+	userID, err := parseUUIDParam(r, "user_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var body rolesRequest
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, err := h.auth.SetRoles(r.Context(), userID, body.Roles, body.Permissions)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrInvalidRole):
+			status = http.StatusBadRequest
+		case errors.Is(err, auth.ErrUserNotFound):
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// websocket streams live updates for a route to a user who may view it, or
+// to anyone holding a public share link for it passed as ?share=.
 func (h *handler) websocket(w http.ResponseWriter, r *http.Request) {
 	if h.ws == nil {
 		writeError(w, http.StatusNotImplemented, "websocket manager not configured")
 		return
 	}
-	userID, err := parseUUIDParam(r, "route_id")
+	routeID, err := parseUUIDParam(r, "route_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if token := r.URL.Query().Get("share"); token != "" {
+		link, ok := h.resolveShareLink(w, r, token)
+		if !ok {
+			return
+		}
+		if link.RouteID != routeID {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		h.ws.ServeWS(w, r, routeID, ws.WithExpiry(link.ExpiresAt))
+		return
+	}
+
+	claims, ok := h.authorizeWebsocket(w, r)
+	if !ok {
+		return
+	}
+	if !claims.HasPermission(models.PermRoutesRead) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if h.routeAuth == nil {
+		writeError(w, http.StatusForbidden, errNoRouteAuth)
+		return
+	}
+	if !claims.HasPermission(models.PermFleetRead) {
+		allowed, err := h.routeAuth.CanViewRoute(r.Context(), claims.UserID, routeID)
+		if err != nil {
+			writeRouteError(w, err)
+			return
+		}
+		if !allowed {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+	}
+	h.ws.ServeWS(w, r, routeID, append(expiryOptions(claims), ws.WithPrincipal(claims))...)
+}
+
+// serveWS subscribes a token holder with perm to the topic named by param.
+func (h *handler) serveWS(w http.ResponseWriter, r *http.Request, param string, perm models.Permission) {
+	if h.ws == nil {
+		writeError(w, http.StatusNotImplemented, "websocket manager not configured")
+		return
+	}
+	id, err := parseUUIDParam(r, param)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	h.ws.ServeWS(w, r, userID)
+	claims, ok := h.authorizeWebsocket(w, r)
+	if !ok {
+		return
+	}
+	if !claims.HasPermission(perm) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	h.ws.ServeWS(w, r, id, append(expiryOptions(claims), ws.WithPrincipal(claims))...)
 }
 
 func decodeJSON(r *http.Request, dst any) error {
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gps/internal/app_services/device"
+	"gps/internal/domain/models"
+)
+
+const (
+	maxIngestBody       = 8 << 20
+	maxIngestPoints     = 1000
+	maxIdempotencyKey   = 128
+	idempotencyTTL      = 24 * time.Hour
+	idempotencyClaimTTL = time.Minute
+
+	deviceIDHeader = "X-Device-ID"
+)
+
+// PointSink is the ingest pipeline; *exchanger.Pool[models.GPSData]
+// implements it, so uploaded points reach the same consumers as points
+// read by the exchangers.
+type PointSink interface {
+	Submit(ctx context.Context, from string, point models.GPSData) error
+}
+
+type DeviceAuthenticator interface {
+	Authenticate(ctx context.Context, imei, key string) (models.Device, error)
+}
+
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, key string, ttl time.Duration) ([]byte, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// WithIngest enables POST /ingest. Without an idempotency store the
+// Idempotency-Key header is ignored.
+func WithIngest(devices DeviceAuthenticator, sink PointSink, idempotency IdempotencyStore) HandlerOption {
+	return func(h *handler) {
+		h.ingestDevices = devices
+		h.ingestSink = sink
+		h.idempotency = idempotency
+	}
+}
+
+// ingestRequest carries points for one device, identified by the IMEI it
+// is registered under. The IMEI comes from the X-Device-ID header; a
+// device_id in the body is optional and must match it.
+type ingestRequest struct {
+	DeviceID string           `json:"device_id"`
+	Points   []models.GPSData `json:"points"`
+}
+
+const (
+	pointAccepted = "accepted"
+	pointRejected = "rejected"
+)
+
+type pointResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ingestResponse reports every point by its index in the request. An
+// accepted point has been handed to the pipeline, not yet stored.
+type ingestResponse struct {
+	DeviceID string        `json:"device_id"`
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []pointResult `json:"results"`
+}
+
+// ingest serves POST /ingest for phones and SDKs. The device names itself in
+// the X-Device-ID header and authenticates with its API key as a bearer
+// token; both are checked before the body is read. Bodies may be
+// gzip-compressed, and an Idempotency-Key header makes a retried upload
+// return the first response instead of submitting the points again.
+func (h *handler) ingest(w http.ResponseWriter, r *http.Request) {
+	if h.ingestDevices == nil || h.ingestSink == nil {
+		writeError(w, http.StatusNotImplemented, "ingestion not configured")
+		return
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		writeError(w, http.StatusUnauthorized, "missing device key")
+		return
+	}
+	deviceID := r.Header.Get(deviceIDHeader)
+	if deviceID == "" {
+		writeError(w, http.StatusBadRequest, "X-Device-ID header is required")
+		return
+	}
+	idemKey := r.Header.Get("Idempotency-Key")
+	if len(idemKey) > maxIdempotencyKey {
+		writeError(w, http.StatusBadRequest, "idempotency key too long")
+		return
+	}
+	if _, err := h.ingestDevices.Authenticate(r.Context(), deviceID, key); err != nil {
+		if errors.Is(err, device.ErrUnknownDevice) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	body, status, err := ingestBody(w, r)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	defer body.Close()
+	var req ingestRequest
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case req.DeviceID != "" && req.DeviceID != deviceID:
+		writeError(w, http.StatusBadRequest, "device_id does not match the X-Device-ID header")
+		return
+	case len(req.Points) == 0:
+		writeError(w, http.StatusBadRequest, "points are required")
+		return
+	case len(req.Points) > maxIngestPoints:
+		writeError(w, http.StatusRequestEntityTooLarge, "too many points")
+		return
+	}
+	req.DeviceID = deviceID
+
+	if idemKey == "" || h.idempotency == nil {
+		writeJSON(w, http.StatusOK, h.submitPoints(r.Context(), req))
+		return
+	}
+	h.idempotentIngest(w, r, "ingest:"+req.DeviceID+":"+idemKey, req)
+}
+
+func (h *handler) idempotentIngest(w http.ResponseWriter, r *http.Request, key string, req ingestRequest) {
+	stored, reserved, err := h.idempotency.ReserveIdempotencyKey(r.Context(), key, idempotencyClaimTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reserved {
+		if stored == nil {
+			writeError(w, http.StatusConflict, "a request with this idempotency key is in progress")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(stored)
+		return
+	}
+
+	resp := h.submitPoints(r.Context(), req)
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		_ = h.idempotency.ReleaseIdempotencyKey(context.WithoutCancel(r.Context()), key)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Points have been submitted, so the key is completed even when some
+	// were rejected; a retry must not submit the accepted ones again.
+	if err := h.idempotency.CompleteIdempotencyKey(context.WithoutCancel(r.Context()), key, raw, idempotencyTTL); err != nil {
+		slog.Warn("Failed to store idempotent response", "key", key, "error", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append(raw, '\n'))
+}
+
+// submitPoints validates each point and hands the valid ones to the sink
+// in order. Once the sink fails, the remaining points are rejected too.
+func (h *handler) submitPoints(ctx context.Context, req ingestRequest) ingestResponse {
+	resp := ingestResponse{DeviceID: req.DeviceID, Results: make([]pointResult, len(req.Points))}
+	now := time.Now()
+	var sinkErr error
+	for i, point := range req.Points {
+		result := pointResult{Index: i, Status: pointAccepted}
+		err := sinkErr
+		if err == nil {
+			err = point.Validate(now)
+		}
+		if err == nil {
+			if err = h.ingestSink.Submit(ctx, req.DeviceID, point); err != nil {
+				sinkErr = err
+			}
+		}
+		if err != nil {
+			result.Status = pointRejected
+			result.Error = err.Error()
+			resp.Rejected++
+		} else {
+			resp.Accepted++
+		}
+		resp.Results[i] = result
+	}
+	return resp
+}
+
+// ingestBody limits the request body and unwraps gzip. The limit applies to
+// the decompressed stream as well.
+func ingestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, int, error) {
+	body := http.MaxBytesReader(w, r.Body, maxIngestBody)
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return body, 0, nil
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid gzip body")
+		}
+		return http.MaxBytesReader(w, gz, maxIngestBody), 0, nil
+	default:
+		return nil, http.StatusUnsupportedMediaType, errors.New("unsupported content encoding")
+	}
+}
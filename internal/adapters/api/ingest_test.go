@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gps/internal/app_services/device"
+	"gps/internal/domain/models"
+)
+
+type fakeDevices struct{}
+
+func (fakeDevices) Authenticate(_ context.Context, imei, key string) (models.Device, error) {
+	if imei == "359339" && key == "device-key" {
+		return models.Device{IMEI: imei}, nil
+	}
+	return models.Device{}, device.ErrUnknownDevice
+}
+
+type recordingSink struct {
+	points []models.GPSData
+	calls  int
+}
+
+func (s *recordingSink) Submit(_ context.Context, from string, point models.GPSData) error {
+	s.calls++
+	s.points = append(s.points, point)
+	return nil
+}
+
+type memoryIdempotency map[string][]byte
+
+func (m memoryIdempotency) ReserveIdempotencyKey(_ context.Context, key string, _ time.Duration) ([]byte, bool, error) {
+	if stored, ok := m[key]; ok {
+		return stored, false, nil
+	}
+	m[key] = nil
+	return nil, true, nil
+}
+
+func (m memoryIdempotency) CompleteIdempotencyKey(_ context.Context, key string, response []byte, _ time.Duration) error {
+	m[key] = response
+	return nil
+}
+
+func (m memoryIdempotency) ReleaseIdempotencyKey(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func ingestRequestBody(t *testing.T, compress bool) *bytes.Buffer {
+	t.Helper()
+	now := time.Now().UTC()
+	raw, err := json.Marshal(ingestRequest{
+		DeviceID: "359339",
+		Points: []models.GPSData{
+			{Location: models.Location{Latitude: 52.5, Longitude: 13.4}, Timestamp: now},
+			{Location: models.Location{Latitude: 91, Longitude: 13.4}, Timestamp: now},
+			{Location: models.Location{Latitude: 52.5, Longitude: 13.4}, Timestamp: now.Add(time.Hour)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compress {
+		return bytes.NewBuffer(raw)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(raw)
+	_ = gz.Close()
+	return &buf
+}
+
+func postIngest(h *handler, body *bytes.Buffer, key, idemKey string, gzipped bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ingest", body)
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set(deviceIDHeader, "359339")
+	if idemKey != "" {
+		req.Header.Set("Idempotency-Key", idemKey)
+	}
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rec := httptest.NewRecorder()
+	h.ingest(rec, req)
+	return rec
+}
+
+func TestIngestPerPointResults(t *testing.T) {
+	sink := &recordingSink{}
+	h := NewHandler(nil, nil, nil, WithIngest(fakeDevices{}, sink, nil))
+
+	rec := postIngest(h, ingestRequestBody(t, true), "device-key", "", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp ingestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 1 || resp.Rejected != 2 || len(sink.points) != 1 {
+		t.Fatalf("resp = %+v, submitted %d", resp, len(sink.points))
+	}
+	if resp.Results[0].Status != pointAccepted || resp.Results[1].Status != pointRejected || resp.Results[2].Error == "" {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+
+	if rec := postIngest(h, ingestRequestBody(t, false), "wrong", "", false); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key status = %d", rec.Code)
+	}
+}
+
+func TestIngestIdempotencyReplay(t *testing.T) {
+	sink := &recordingSink{}
+	h := NewHandler(nil, nil, nil, WithIngest(fakeDevices{}, sink, memoryIdempotency{}))
+
+	first := postIngest(h, ingestRequestBody(t, false), "device-key", "upload-1", false)
+	second := postIngest(h, ingestRequestBody(t, false), "device-key", "upload-1", false)
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("status = %d, %d", first.Code, second.Code)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("retry was not replayed")
+	}
+	if !bytes.Equal(bytes.TrimSpace(first.Body.Bytes()), bytes.TrimSpace(second.Body.Bytes())) {
+		t.Fatalf("replayed body differs:\n%s\n%s", first.Body, second.Body)
+	}
+	if len(sink.points) != 1 {
+		t.Fatalf("submitted %d points, want 1", len(sink.points))
+	}
+}
+
+func TestIngestRetryDoesNotSubmitAgain(t *testing.T) {
+	sink := &recordingSink{}
+	h := NewHandler(nil, nil, nil, WithIngest(fakeDevices{}, sink, memoryIdempotency{}))
+
+	if rec := postIngest(h, ingestRequestBody(t, true), "device-key", "upload-2", true); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	calls := sink.calls
+	if calls == 0 {
+		t.Fatal("first request submitted nothing")
+	}
+	for range 3 {
+		if rec := postIngest(h, ingestRequestBody(t, true), "device-key", "upload-2", true); rec.Code != http.StatusOK {
+			t.Fatalf("retry status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+	if sink.calls != calls {
+		t.Fatalf("retries called Submit %d more times", sink.calls-calls)
+	}
+
+	if rec := postIngest(h, ingestRequestBody(t, true), "device-key", "upload-3", true); rec.Code != http.StatusOK || sink.calls == calls {
+		t.Fatalf("a new key must submit again, status = %d", rec.Code)
+	}
+}
+
+// badBody fails the test if the handler reads it.
+type badBody struct{ t *testing.T }
+
+func (b badBody) Read([]byte) (int, error) {
+	b.t.Error("body read before the device was authenticated")
+	return 0, io.EOF
+}
+
+func TestIngestAuthenticatesBeforeReadingBody(t *testing.T) {
+	h := NewHandler(nil, nil, nil, WithIngest(fakeDevices{}, &recordingSink{}, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", badBody{t})
+	req.Header.Set("Authorization", "Bearer wrong")
+	req.Header.Set(deviceIDHeader, "359339")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ingest(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
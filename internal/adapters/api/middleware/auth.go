@@ -5,34 +5,96 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
+
+	"gps/internal/app_services/auth"
+	"gps/internal/domain/models"
 )
 
 type contextKey string
 
 const (
-	userIDContextKey contextKey = "user_id"
+	userIDContextKey   contextKey = "user_id"
+	identityContextKey contextKey = "identity"
 )
 
 var ErrUnauthorized = errors.New("unauthorized")
 
+// Identity is what a validated token says about its holder: the user, their
+// grants and the registered claims of the token itself.
+type Identity struct {
+	UserID      string              `json:"user_id"`
+	Username    string              `json:"username,omitempty"`
+	Roles       []models.Role       `json:"roles"`
+	Permissions []models.Permission `json:"permissions"`
+	TokenID     string              `json:"jti,omitempty"`
+	Issuer      string              `json:"iss,omitempty"`
+	Audience    []string            `json:"aud,omitempty"`
+	IssuedAt    time.Time           `json:"iat,omitzero"`
+	ExpiresAt   time.Time           `json:"exp,omitzero"`
+	// Unrestricted is set when authentication is disabled; every
+	// permission check passes.
+	Unrestricted bool `json:"-"`
+}
+
+// IdentityFromClaims copies validated token claims into an Identity.
+func IdentityFromClaims(claims auth.JWTClaims) Identity {
+	identity := Identity{
+		UserID:      claims.UserID.String(),
+		Username:    claims.Username,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		TokenID:     claims.ID,
+		Issuer:      claims.Issuer,
+		Audience:    claims.Audience,
+	}
+	if claims.IssuedAt != nil {
+		identity.IssuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		identity.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return identity
+}
+
+func (i Identity) HasPermission(perm models.Permission) bool {
+	return i.Unrestricted || slices.Contains(i.Permissions, perm)
+}
+
 type AuthClient interface {
-	ValidateToken(ctx context.Context, token string) (string, error)
+	ValidateToken(ctx context.Context, token string) (Identity, error)
 }
 
+// BaseAuthClient validates tokens against a remote /auth/validate
+// endpoint.
 type BaseAuthClient struct {
 	baseURL      string
 	validatePath string
 	disabled     bool
 	client       *http.Client
+	cache        *identityCache
+}
+
+type BaseAuthClientOption func(*BaseAuthClient)
+
+// WithValidationCache remembers up to size validated tokens for ttl, or
+// until the token expires if sooner. A token revoked on the auth service
+// keeps working here until its entry ages out.
+func WithValidationCache(size int, ttl time.Duration) BaseAuthClientOption {
+	return func(c *BaseAuthClient) {
+		if size > 0 && ttl > 0 {
+			c.cache = newIdentityCache(size, ttl)
+		}
+	}
 }
 
-func NewBaseAuthClient(baseURL, validatePath string, disabled bool) *BaseAuthClient {
+func NewBaseAuthClient(baseURL, validatePath string, disabled bool, opts ...BaseAuthClientOption) *BaseAuthClient {
 	if validatePath == "" {
 		validatePath = "/auth/validate"
 	}
-	return &BaseAuthClient{
+	c := &BaseAuthClient{
 		baseURL:      strings.TrimRight(baseURL, "/"),
 		validatePath: validatePath,
 		disabled:     disabled,
@@ -40,41 +102,74 @@ func NewBaseAuthClient(baseURL, validatePath string, disabled bool) *BaseAuthCli
 			Timeout: 5 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-func (c *BaseAuthClient) ValidateToken(ctx context.Context, token string) (string, error) {
+func (c *BaseAuthClient) ValidateToken(ctx context.Context, token string) (Identity, error) {
 	if c.disabled {
-		return "", nil
+		return Identity{Unrestricted: true}, nil
 	}
 	if c.baseURL == "" {
-		return "", ErrUnauthorized
+		return Identity{}, ErrUnauthorized
+	}
+	if identity, ok := c.cache.get(token); ok {
+		return identity, nil
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+c.validatePath, nil)
 	if err != nil {
-		return "", err
+		return Identity{}, err
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", err
+		return Identity{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		return "", ErrUnauthorized
+		return Identity{}, ErrUnauthorized
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", errors.New("auth service error")
+		return Identity{}, errors.New("auth service error")
 	}
 
-	var payload struct {
-		UserID string `json:"user_id"`
+	var identity Identity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return Identity{}, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return "", err
+	c.cache.put(token, identity)
+	return identity, nil
+}
+
+// TokenValidator checks a token in-process; auth.AuthService implements it.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (auth.JWTClaims, error)
+}
+
+// LocalAuthClient validates tokens in-process with the same signer and
+// denylist the auth service uses, avoiding a round trip per request.
+// Issuer, audience and clock skew are enforced by the validator.
+type LocalAuthClient struct {
+	validator TokenValidator
+}
+
+func NewLocalAuthClient(validator TokenValidator) *LocalAuthClient {
+	return &LocalAuthClient{validator: validator}
+}
+
+func (c *LocalAuthClient) ValidateToken(ctx context.Context, token string) (Identity, error) {
+	claims, err := c.validator.ValidateToken(ctx, token)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+		return Identity{}, ErrUnauthorized
+	}
+	if err != nil {
+		return Identity{}, err
 	}
-	return payload.UserID, nil
+	return IdentityFromClaims(claims), nil
 }
 
 func AuthMiddleware(authClient AuthClient) Middleware {
@@ -96,7 +191,7 @@ func AuthMiddleware(authClient AuthClient) Middleware {
 				return
 			}
 
-			userID, err := authClient.ValidateToken(ctx, token)
+			identity, err := authClient.ValidateToken(ctx, token)
 			if err != nil {
 				status := http.StatusInternalServerError
 				if errors.Is(err, ErrUnauthorized) {
@@ -106,7 +201,8 @@ func AuthMiddleware(authClient AuthClient) Middleware {
 				return
 			}
 
-			ctx = context.WithValue(ctx, userIDContextKey, userID)
+			ctx = context.WithValue(ctx, userIDContextKey, identity.UserID)
+			ctx = context.WithValue(ctx, identityContextKey, identity)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
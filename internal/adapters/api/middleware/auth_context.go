@@ -14,3 +14,11 @@ func GetUserIDFromContext(ctx context.Context) (string, error) {
 	}
 	return userID, nil
 }
+
+func GetIdentityFromContext(ctx context.Context) (Identity, error) {
+	identity, ok := ctx.Value(identityContextKey).(Identity)
+	if !ok {
+		return Identity{}, ErrNoUserInContext
+	}
+	return identity, nil
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gps/internal/app_services/auth"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type fakeValidator struct {
+	claims auth.JWTClaims
+	err    error
+}
+
+func (f fakeValidator) ValidateToken(context.Context, string) (auth.JWTClaims, error) {
+	return f.claims, f.err
+}
+
+func TestLocalAuthClient(t *testing.T) {
+	signer, err := auth.NewHMACSigner([]byte("secret"), "k1", time.Minute, auth.WithIssuer("gps"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := auth.NewAuthService(nil, signer)
+	userID := uuid.New()
+	token, err := signer.Sign(auth.JWTClaims{
+		UserID:      userID,
+		Username:    "alice",
+		Permissions: []models.Permission{models.PermRoutesRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewLocalAuthClient(svc)
+	identity, err := client.ValidateToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != userID.String() || identity.Username != "alice" || identity.Issuer != "gps" || identity.TokenID == "" {
+		t.Fatalf("identity = %+v", identity)
+	}
+	if !identity.HasPermission(models.PermRoutesRead) || identity.ExpiresAt.IsZero() {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	if _, err := client.ValidateToken(context.Background(), token+"x"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("tampered token err = %v, want ErrUnauthorized", err)
+	}
+	outage := errors.New("redis down")
+	if _, err := NewLocalAuthClient(fakeValidator{err: outage}).ValidateToken(context.Background(), token); !errors.Is(err, outage) {
+		t.Fatalf("backend failure err = %v, want it passed through", err)
+	}
+}
+
+func TestAuthMiddlewareStoresIdentity(t *testing.T) {
+	claims := auth.JWTClaims{UserID: uuid.New(), Username: "bob"}
+	var got Identity
+	handler := AuthMiddleware(NewLocalAuthClient(fakeValidator{claims: claims}))(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = GetIdentityFromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	handler(httptest.NewRecorder(), req)
+	if got.Username != "bob" || got.UserID != claims.UserID.String() {
+		t.Fatalf("identity = %+v", got)
+	}
+}
+
+func TestBaseAuthClientCache(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_ = json.NewEncoder(w).Encode(Identity{UserID: r.Header.Get("Authorization")})
+	}))
+	defer server.Close()
+
+	client := NewBaseAuthClient(server.URL, "", false, WithValidationCache(1, time.Minute))
+	ctx := context.Background()
+	for range 3 {
+		identity, err := client.ValidateToken(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.UserID != "Bearer a" {
+			t.Fatalf("identity = %+v", identity)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("remote calls = %d, want 1", n)
+	}
+
+	// A second token evicts the first from a one-entry cache.
+	if _, err := client.ValidateToken(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ValidateToken(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("remote calls = %d, want 3", n)
+	}
+}
+
+func TestIdentityCacheHonoursTokenExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := newIdentityCache(4, time.Hour)
+	cache.now = func() time.Time { return now }
+	cache.put("t", Identity{UserID: "u", ExpiresAt: now.Add(time.Second)})
+	if _, ok := cache.get("t"); !ok {
+		t.Fatal("fresh entry missing")
+	}
+	now = now.Add(2 * time.Second)
+	if _, ok := cache.get("t"); ok {
+		t.Fatal("entry outlived its token")
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// identityCache is a fixed-size LRU of validated tokens. Keys are token
+// hashes so raw tokens are not kept in memory longer than needed.
+type identityCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key       [sha256.Size]byte
+	identity  Identity
+	expiresAt time.Time
+}
+
+func newIdentityCache(size int, ttl time.Duration) *identityCache {
+	return &identityCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element, size),
+		now:     time.Now,
+	}
+}
+
+// get is safe on a nil cache, which never hits.
+func (c *identityCache) get(token string) (Identity, bool) {
+	if c == nil {
+		return Identity{}, false
+	}
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return Identity{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return Identity{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.identity, true
+}
+
+func (c *identityCache) put(token string, identity Identity) {
+	if c == nil {
+		return
+	}
+	expiresAt := c.now().Add(c.ttl)
+	if !identity.ExpiresAt.IsZero() && identity.ExpiresAt.Before(expiresAt) {
+		expiresAt = identity.ExpiresAt
+	}
+	key := sha256.Sum256([]byte(token))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.identity = identity
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, identity: identity, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
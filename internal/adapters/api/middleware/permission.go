@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"gps/internal/domain/models"
+)
+
+// RequirePermission rejects requests whose identity lacks perm. It must run
+// after AuthMiddleware.
+func RequirePermission(perm models.Permission) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := GetIdentityFromContext(r.Context())
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !identity.HasPermission(perm) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
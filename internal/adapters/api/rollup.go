@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type RollupService interface {
+	Query(ctx context.Context, q models.RollupQuery) ([]models.RollupResult, error)
+}
+
+func WithRollups(svc RollupService) HandlerOption {
+	return func(h *handler) {
+		h.rollups = svc
+	}
+}
+
+// queryRollups serves GET /rollups?from=&to=&bucket=1h&group_by=device with
+// optional device_id, route_id and user_id filters. Times are RFC 3339.
+func (h *handler) queryRollups(w http.ResponseWriter, r *http.Request) {
+	if h.rollups == nil {
+		writeError(w, http.StatusNotImplemented, "rollup service not configured")
+		return
+	}
+	q, err := parseRollupQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.rollups.Query(r.Context(), q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrInvalidRollupQuery) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func parseRollupQuery(r *http.Request) (models.RollupQuery, error) {
+	values := r.URL.Query()
+	q := models.RollupQuery{
+		GroupBy:  models.RollupGroupBy(values.Get("group_by")),
+		DeviceID: values.Get("device_id"),
+	}
+	var err error
+	if raw := values.Get("from"); raw != "" {
+		if q.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, errors.New("invalid from")
+		}
+	}
+	if raw := values.Get("to"); raw != "" {
+		if q.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, errors.New("invalid to")
+		}
+	}
+	if raw := values.Get("bucket"); raw != "" {
+		if q.BucketSize, err = time.ParseDuration(raw); err != nil || q.BucketSize <= 0 {
+			return q, errors.New("invalid bucket")
+		}
+	}
+	if raw := values.Get("route_id"); raw != "" {
+		if q.RouteID, err = uuid.Parse(raw); err != nil {
+			return q, errors.New("invalid route_id")
+		}
+	}
+	if raw := values.Get("user_id"); raw != "" {
+		if q.UserID, err = uuid.Parse(raw); err != nil {
+			return q, errors.New("invalid user_id")
+		}
+	}
+	return q, nil
+}
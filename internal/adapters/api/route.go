@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gps/internal/adapters/api/middleware"
+	"gps/internal/app_services/route"
+	"gps/internal/app_services/sharing"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// exportFlushEvery is how many NDJSON lines are written between flushes.
+const exportFlushEvery = 500
+
+type RouteService interface {
+	Create(ctx context.Context, ownerID uuid.UUID, route models.Route) (models.Route, error)
+	Page(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error)
+	Export(ctx context.Context, routeID uuid.UUID, fn func(models.GPSData) error) error
+	Smoothed(ctx context.Context, routeID uuid.UUID) ([]models.GPSData, error)
+}
+
+func WithRoutes(svc RouteService) HandlerOption {
+	return func(h *handler) {
+		h.routes = svc
+	}
+}
+
+// createRoute serves POST /routes. The route is owned by the caller.
+func (h *handler) createRoute(w http.ResponseWriter, r *http.Request) {
+	if h.routes == nil {
+		writeError(w, http.StatusNotImplemented, "route service not configured")
+		return
+	}
+	userID, err := requestUserID(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var body models.Route
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.routes.Create(r.Context(), userID, body)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"route_id": created.RouteID.String()})
+}
+
+// listRoutes serves GET /routes with the ids of the caller's routes.
+func (h *handler) listRoutes(w http.ResponseWriter, r *http.Request) {
+	if h.sharing == nil {
+		writeError(w, http.StatusNotImplemented, "sharing service not configured")
+		return
+	}
+	userID, err := requestUserID(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	ids, err := h.sharing.OwnedRoutes(r.Context(), userID)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]uuid.UUID{"route_ids": ids})
+}
+
+// routePoints serves GET /routes/{route_id}/points?after=&limit=. after is
+// the next_cursor of the previous page; a bare RFC 3339 timestamp starts at
+// the first point at or after that time.
+func (h *handler) routePoints(w http.ResponseWriter, r *http.Request) {
+	routeID, ok := h.authorizeRouteRead(w, r)
+	if !ok {
+		return
+	}
+	h.writePage(w, r, routeID)
+}
+
+// exportRoute serves GET /routes/{route_id}/export as NDJSON, one point per
+// line, streaming pages as they are read.
+func (h *handler) exportRoute(w http.ResponseWriter, r *http.Request) {
+	routeID, ok := h.authorizeRouteRead(w, r)
+	if !ok {
+		return
+	}
+	h.writeExport(w, r, routeID)
+}
+
+// smoothedRoute serves GET /routes/{route_id}/smoothed with the whole path
+// after offline Kalman smoothing.
+func (h *handler) smoothedRoute(w http.ResponseWriter, r *http.Request) {
+	routeID, ok := h.authorizeRouteRead(w, r)
+	if !ok {
+		return
+	}
+	if h.routes == nil {
+		writeError(w, http.StatusNotImplemented, "route service not configured")
+		return
+	}
+	path, err := h.routes.Smoothed(r.Context(), routeID)
+	if errors.Is(err, route.ErrSmoothingDisabled) {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]models.GPSData{"points": path})
+}
+
+func (h *handler) writePage(w http.ResponseWriter, r *http.Request, routeID uuid.UUID) {
+	if h.routes == nil {
+		writeError(w, http.StatusNotImplemented, "route service not configured")
+		return
+	}
+	after, limit, err := parsePageQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.routes.Page(r.Context(), routeID, after, limit)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *handler) writeExport(w http.ResponseWriter, r *http.Request, routeID uuid.UUID) {
+	if h.routes == nil {
+		writeError(w, http.StatusNotImplemented, "route service not configured")
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	written := 0
+	err := h.routes.Export(r.Context(), routeID, func(point models.GPSData) error {
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := enc.Encode(point); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && written == 0 {
+		writeRouteError(w, err)
+		return
+	}
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// authorizeRouteRead parses the route id and checks that the caller may
+// read it. It writes the error response itself and returns false on failure.
+func (h *handler) authorizeRouteRead(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	routeID, err := parseUUIDParam(r, "route_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return uuid.Nil, false
+	}
+	if h.routeAuth == nil {
+		writeError(w, http.StatusForbidden, errNoRouteAuth)
+		return uuid.Nil, false
+	}
+	if identity, err := middleware.GetIdentityFromContext(r.Context()); err == nil && identity.HasPermission(models.PermFleetRead) {
+		return routeID, true
+	}
+	userID, err := requestUserID(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, false
+	}
+	allowed, err := h.routeAuth.CanViewRoute(r.Context(), userID, routeID)
+	if err != nil {
+		writeRouteError(w, err)
+		return uuid.Nil, false
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return uuid.Nil, false
+	}
+	return routeID, true
+}
+
+func requestUserID(r *http.Request) (uuid.UUID, error) {
+	raw, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, middleware.ErrNoUserInContext
+	}
+	return userID, nil
+}
+
+func parsePageQuery(r *http.Request) (models.PathCursor, int, error) {
+	values := r.URL.Query()
+	after, err := models.ParsePathCursor(values.Get("after"))
+	if err != nil {
+		return models.PathCursor{}, 0, errors.New("invalid after")
+	}
+	limit := 0
+	if raw := values.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return models.PathCursor{}, 0, errors.New("invalid limit")
+		}
+		limit = parsed
+	}
+	return after, limit, nil
+}
+
+func writeRouteError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrRouteNotFound),
+		errors.Is(err, models.ErrShareNotFound),
+		errors.Is(err, models.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, sharing.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, sharing.ErrInvalidShare),
+		errors.Is(err, route.ErrInvalidRoute):
+		status = http.StatusBadRequest
+	}
+	writeError(w, status, err.Error())
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type SharingService interface {
+	RouteAuthorizer
+	OwnedRoutes(ctx context.Context, ownerID uuid.UUID) ([]uuid.UUID, error)
+	ShareWithUser(ctx context.Context, ownerID, routeID uuid.UUID, username string) (models.RouteShare, error)
+	Unshare(ctx context.Context, ownerID, routeID, userID uuid.UUID) error
+	Shares(ctx context.Context, ownerID, routeID uuid.UUID) ([]models.RouteShare, error)
+	CreateLink(ctx context.Context, ownerID, routeID uuid.UUID, ttl time.Duration) (string, models.ShareLink, error)
+	Links(ctx context.Context, ownerID, routeID uuid.UUID) ([]models.ShareLink, error)
+	RevokeLink(ctx context.Context, ownerID, routeID, linkID uuid.UUID) error
+	ResolveLink(ctx context.Context, token string) (models.ShareLink, error)
+}
+
+// WithSharing enforces route ownership and shares on every route endpoint
+// and websocket subscription.
+func WithSharing(svc SharingService) HandlerOption {
+	return func(h *handler) {
+		h.sharing = svc
+		h.routeAuth = svc
+	}
+}
+
+type shareRequest struct {
+	Username string `json:"username"`
+}
+
+type linkRequest struct {
+	// TTL is a Go duration such as "2h"; empty selects the default.
+	TTL string `json:"ttl"`
+}
+
+type linkResponse struct {
+	models.ShareLink
+	Token string `json:"token"`
+}
+
+// ownerRequest parses the route id and caller for the owner-only share
+// endpoints. It writes the error response itself and returns false on
+// failure.
+func (h *handler) ownerRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	if h.sharing == nil {
+		writeError(w, http.StatusNotImplemented, "sharing service not configured")
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := requestUserID(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+	routeID, err := parseUUIDParam(r, "route_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, routeID, true
+}
+
+func (h *handler) shareRoute(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	var body shareRequest
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	share, err := h.sharing.ShareWithUser(r.Context(), userID, routeID, body.Username)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, share)
+}
+
+func (h *handler) listShares(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	shares, err := h.sharing.Shares(r.Context(), userID, routeID)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, shares)
+}
+
+func (h *handler) unshareRoute(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	target, err := parseUUIDParam(r, "user_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.sharing.Unshare(r.Context(), userID, routeID, target); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) createShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	var body linkRequest
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ttl time.Duration
+	if body.TTL != "" {
+		parsed, err := time.ParseDuration(body.TTL)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl")
+			return
+		}
+		ttl = parsed
+	}
+	token, link, err := h.sharing.CreateLink(r.Context(), userID, routeID, ttl)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, linkResponse{ShareLink: link, Token: token})
+}
+
+func (h *handler) listShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	links, err := h.sharing.Links(r.Context(), userID, routeID)
+	if err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, links)
+}
+
+func (h *handler) revokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, routeID, ok := h.ownerRequest(w, r)
+	if !ok {
+		return
+	}
+	linkID, err := parseUUIDParam(r, "link_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.sharing.RevokeLink(r.Context(), userID, routeID, linkID); err != nil {
+		writeRouteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedPoints serves GET /shared/{token}/points without a login.
+func (h *handler) sharedPoints(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.resolveShareLink(w, r, r.PathValue("token"))
+	if !ok {
+		return
+	}
+	h.writePage(w, r, link.RouteID)
+}
+
+// sharedExport serves GET /shared/{token}/export without a login.
+func (h *handler) sharedExport(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.resolveShareLink(w, r, r.PathValue("token"))
+	if !ok {
+		return
+	}
+	h.writeExport(w, r, link.RouteID)
+}
+
+func (h *handler) resolveShareLink(w http.ResponseWriter, r *http.Request, token string) (models.ShareLink, bool) {
+	if h.sharing == nil {
+		writeError(w, http.StatusNotImplemented, "sharing service not configured")
+		return models.ShareLink{}, false
+	}
+	link, err := h.sharing.ResolveLink(r.Context(), token)
+	if err != nil {
+		writeRouteError(w, err)
+		return models.ShareLink{}, false
+	}
+	return link, true
+}
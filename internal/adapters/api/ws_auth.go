@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gps/internal/app_services/auth"
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+)
+
+var errMissingToken = errors.New("missing token")
+
+// errNoRouteAuth is the response when the handler has no RouteAuthorizer;
+// route reads and subscriptions fail closed.
+const errNoRouteAuth = "route authorization is not configured"
+
+// RouteAuthorizer decides whether a user may read or watch a route. Route
+// reads and subscriptions are denied when the handler has none.
+type RouteAuthorizer interface {
+	CanViewRoute(ctx context.Context, userID, routeID uuid.UUID) (bool, error)
+}
+
+func WithRouteAuthorizer(authorizer RouteAuthorizer) HandlerOption {
+	return func(h *handler) {
+		h.routeAuth = authorizer
+	}
+}
+
+// websocketToken reads the token from the access_token query parameter or
+// from the Sec-WebSocket-Protocol header offered as "bearer, <token>".
+func websocketToken(r *http.Request) (string, error) {
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token, nil
+	}
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.TrimSpace(protocols[i]) == ws.BearerProtocol {
+			if token := strings.TrimSpace(protocols[i+1]); token != "" {
+				return token, nil
+			}
+		}
+	}
+	return "", errMissingToken
+}
+
+// authorizeWebsocket validates the upgrade token and returns its claims.
+// It writes the error response itself and returns false on failure.
+func (h *handler) authorizeWebsocket(w http.ResponseWriter, r *http.Request) (auth.JWTClaims, bool) {
+	if h.auth == nil {
+		writeError(w, http.StatusNotImplemented, "auth service not configured")
+		return auth.JWTClaims{}, false
+	}
+	token, err := websocketToken(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return auth.JWTClaims{}, false
+	}
+	claims, err := h.auth.ValidateToken(r.Context(), token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return auth.JWTClaims{}, false
+	}
+	return claims, true
+}
+
+func expiryOptions(claims auth.JWTClaims) []ws.ServeOption {
+	if claims.ExpiresAt == nil {
+		return nil
+	}
+	return []ws.ServeOption{ws.WithExpiry(claims.ExpiresAt.Time)}
+}
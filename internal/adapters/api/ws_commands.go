@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gps/internal/app_services/auth"
+	"gps/internal/domain/models"
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+)
+
+// Client commands of the websocket protocol.
+const (
+	commandSubscribe   = "subscribe"
+	commandUnsubscribe = "unsubscribe"
+	commandBackfill    = "backfill"
+	commandRate        = "rate"
+)
+
+const maxUpdateInterval = time.Minute
+
+type topicCommand struct {
+	RouteID uuid.UUID `json:"route_id"`
+}
+
+type backfillCommand struct {
+	RouteID uuid.UUID         `json:"route_id"`
+	After   models.PathCursor `json:"after"`
+	Limit   int               `json:"limit"`
+}
+
+type rateCommand struct {
+	// IntervalMS is the minimum time between updates of one route; zero
+	// sends every update.
+	IntervalMS int64 `json:"interval_ms"`
+}
+
+// commands builds the dispatcher for messages clients send over their
+// websocket.
+func (h *handler) commands() *ws.Dispatcher {
+	d := ws.NewDispatcher()
+	d.Handle(commandSubscribe, h.subscribeCommand)
+	d.Handle(commandUnsubscribe, h.unsubscribeCommand)
+	d.Handle(commandBackfill, h.backfillCommand)
+	d.Handle(commandRate, rateCommandHandler)
+	return d
+}
+
+func (h *handler) subscribeCommand(ctx context.Context, c *ws.Client, data json.RawMessage) (any, error) {
+	var cmd topicCommand
+	if err := decodeCommand(data, &cmd); err != nil {
+		return nil, err
+	}
+	if err := h.authorizeTopic(ctx, c, cmd.RouteID); err != nil {
+		return nil, err
+	}
+	h.ws.Subscribe(c, cmd.RouteID)
+	return nil, nil
+}
+
+func (h *handler) unsubscribeCommand(_ context.Context, c *ws.Client, data json.RawMessage) (any, error) {
+	var cmd topicCommand
+	if err := decodeCommand(data, &cmd); err != nil {
+		return nil, err
+	}
+	if !h.ws.Unsubscribe(c, cmd.RouteID) {
+		return nil, ws.NewCommandError(ws.CodeNotFound, "not subscribed")
+	}
+	return nil, nil
+}
+
+// backfillCommand answers with one page of stored points, like GET
+// /routes/{route_id}/points; the ack carries the page.
+func (h *handler) backfillCommand(ctx context.Context, c *ws.Client, data json.RawMessage) (any, error) {
+	if h.routes == nil {
+		return nil, ws.NewCommandError(ws.CodeUnknownCommand, "backfill not available")
+	}
+	var cmd backfillCommand
+	if err := decodeCommand(data, &cmd); err != nil {
+		return nil, err
+	}
+	if err := h.authorizeTopic(ctx, c, cmd.RouteID); err != nil {
+		return nil, err
+	}
+	page, err := h.routes.Page(ctx, cmd.RouteID, cmd.After, cmd.Limit)
+	if errors.Is(err, models.ErrRouteNotFound) {
+		return nil, ws.NewCommandError(ws.CodeNotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func rateCommandHandler(_ context.Context, c *ws.Client, data json.RawMessage) (any, error) {
+	var cmd rateCommand
+	if err := decodeCommand(data, &cmd); err != nil {
+		return nil, err
+	}
+	interval := time.Duration(cmd.IntervalMS) * time.Millisecond
+	if interval < 0 || interval > maxUpdateInterval {
+		return nil, ws.NewCommandError(ws.CodeBadRequest, "interval_ms must be between 0 and 60000")
+	}
+	c.SetInterval(interval)
+	return nil, nil
+}
+
+// authorizeTopic applies the upgrade checks of the websocket handler to a
+// route named in a command. The route the socket was opened for was
+// checked at upgrade; share link sockets carry no claims and are limited
+// to it.
+func (h *handler) authorizeTopic(ctx context.Context, c *ws.Client, routeID uuid.UUID) error {
+	if routeID == c.ID() {
+		return nil
+	}
+	claims, ok := c.Principal().(auth.JWTClaims)
+	if !ok || !claims.HasPermission(models.PermRoutesRead) {
+		return ws.NewCommandError(ws.CodeForbidden, "forbidden")
+	}
+	if h.routeAuth == nil {
+		return ws.NewCommandError(ws.CodeForbidden, errNoRouteAuth)
+	}
+	if claims.HasPermission(models.PermFleetRead) {
+		return nil
+	}
+	allowed, err := h.routeAuth.CanViewRoute(ctx, claims.UserID, routeID)
+	if errors.Is(err, models.ErrRouteNotFound) {
+		return ws.NewCommandError(ws.CodeNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ws.NewCommandError(ws.CodeForbidden, "forbidden")
+	}
+	return nil
+}
+
+func decodeCommand(data json.RawMessage, dst any) error {
+	if len(data) == 0 {
+		return ws.NewCommandError(ws.CodeBadRequest, "data is required")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return ws.NewCommandError(ws.CodeBadRequest, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const channelPrefix = "ws:"
+
+var _ ws.Broker = (*RedisBroker)(nil)
+
+// publisher and subscription are the parts of *redis.Client and
+// *redis.PubSub the broker uses.
+type publisher interface {
+	Publish(ctx context.Context, channel string, message any) *redis.IntCmd
+}
+
+type subscription interface {
+	Subscribe(ctx context.Context, channels ...string) error
+	Unsubscribe(ctx context.Context, channels ...string) error
+	Channel(opts ...redis.ChannelOption) <-chan *redis.Message
+	Close() error
+}
+
+// RedisBroker publishes websocket messages to one Redis pub/sub channel per
+// topic. All replicas share the channels, so a message written on any of
+// them reaches the clients connected to every other.
+type RedisBroker struct {
+	client publisher
+	pubsub subscription
+}
+
+// NewRedisBroker opens a pub/sub connection with no channels; the manager
+// subscribes to topics as clients connect.
+func NewRedisBroker(ctx context.Context, client *redis.Client) (*RedisBroker, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis client is required")
+	}
+	return &RedisBroker{
+		client: client,
+		pubsub: client.Subscribe(ctx),
+	}, nil
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, message ws.WriteToWs) error {
+	return b.client.Publish(ctx, channelName(message.ConsumerID), message.Payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, topic uuid.UUID) error {
+	return b.pubsub.Subscribe(ctx, channelName(topic))
+}
+
+func (b *RedisBroker) Unsubscribe(ctx context.Context, topic uuid.UUID) error {
+	return b.pubsub.Unsubscribe(ctx, channelName(topic))
+}
+
+// Listen delivers received messages until ctx is cancelled and then closes
+// the pub/sub connection.
+func (b *RedisBroker) Listen(ctx context.Context, deliver func(ws.WriteToWs)) {
+	defer b.pubsub.Close()
+	messages := b.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			topic, err := uuid.Parse(strings.TrimPrefix(msg.Channel, channelPrefix))
+			if err != nil {
+				slog.Warn("Ignoring message on unexpected channel", "channel", msg.Channel)
+				continue
+			}
+			deliver(ws.WriteToWs{Payload: []byte(msg.Payload), ConsumerID: topic})
+		}
+	}
+}
+
+func channelName(topic uuid.UUID) string {
+	return channelPrefix + topic.String()
+}
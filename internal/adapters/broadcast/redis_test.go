@@ -0,0 +1,117 @@
+package broadcast
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakePubSub routes published messages to its own channel when the
+// subscription covers them, like one Redis server with one subscriber.
+type fakePubSub struct {
+	mu       sync.Mutex
+	channels []string
+	messages chan *redis.Message
+	closed   bool
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{messages: make(chan *redis.Message, 16)}
+}
+
+func (f *fakePubSub) Publish(_ context.Context, channel string, message any) *redis.IntCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.channels, channel) {
+		return redis.NewIntResult(0, nil)
+	}
+	f.messages <- &redis.Message{Channel: channel, Payload: string(message.([]byte))}
+	return redis.NewIntResult(1, nil)
+}
+
+func (f *fakePubSub) Subscribe(_ context.Context, channels ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels = append(f.channels, channels...)
+	return nil
+}
+
+func (f *fakePubSub) Unsubscribe(_ context.Context, channels ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels = slices.DeleteFunc(f.channels, func(c string) bool { return slices.Contains(channels, c) })
+	return nil
+}
+
+func (f *fakePubSub) Channel(...redis.ChannelOption) <-chan *redis.Message {
+	return f.messages
+}
+
+func (f *fakePubSub) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func TestRedisBrokerRoundTrip(t *testing.T) {
+	fake := newFakePubSub()
+	var broker ws.Broker = &RedisBroker{client: fake, pubsub: fake}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := make(chan ws.WriteToWs, 4)
+	listening := make(chan struct{})
+	go func() {
+		broker.Listen(ctx, func(m ws.WriteToWs) { delivered <- m })
+		close(listening)
+	}()
+
+	topic, other := uuid.New(), uuid.New()
+	if err := broker.Subscribe(ctx, topic); err != nil {
+		t.Fatal(err)
+	}
+	// A foreign channel on the connection must not reach the manager.
+	fake.messages <- &redis.Message{Channel: "other", Payload: "x"}
+	if err := broker.Publish(ctx, ws.WriteToWs{ConsumerID: other, Payload: []byte("not subscribed")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(ctx, ws.WriteToWs{ConsumerID: topic, Payload: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-delivered:
+		if got.ConsumerID != topic || string(got.Payload) != "hello" {
+			t.Fatalf("delivered %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not delivered")
+	}
+
+	if err := broker.Unsubscribe(ctx, topic); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(ctx, ws.WriteToWs{ConsumerID: topic, Payload: []byte("after unsubscribe")}); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case <-listening:
+	case <-time.After(time.Second):
+		t.Fatal("Listen did not return after cancel")
+	}
+	if len(delivered) != 0 {
+		t.Fatalf("unexpected delivery %+v", <-delivered)
+	}
+	if !fake.closed {
+		t.Fatal("Listen did not close the subscription")
+	}
+}
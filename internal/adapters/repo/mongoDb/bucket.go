@@ -0,0 +1,227 @@
+package mongoDb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	defaultBucketSize = 500
+	maxAppendRetries  = 5
+	bucketCollection  = "route_buckets"
+)
+
+func ensureBucketCollection(ctx context.Context, db *mongo.Database) (*mongo.Collection, error) {
+	coll := db.Collection(bucketCollection)
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "route_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "end", Value: 1}}},
+		{Keys: bson.D{{Key: "route_id", Value: 1}, {Key: "end", Value: 1}, {Key: "start", Value: 1}}},
+		{Keys: bson.D{{Key: "route_id", Value: 1}, {Key: "start", Value: 1}, {Key: "end", Value: 1}}},
+		{Keys: bson.M{"points.geo": "2dsphere"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+// StreamRoutePath calls fn for every point of the route in bucket order
+// without loading the whole path into memory.
+func (m *Repository) StreamRoutePath(ctx context.Context, routeID uuid.UUID, fn func(models.GPSData) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := m.bucketColl.Find(ctx, bson.M{"route_id": routeID}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var bucket bucketDocument
+		if err := cursor.Decode(&bucket); err != nil {
+			return err
+		}
+		for _, p := range bucket.Points {
+			if err := fn(p.toModel()); err != nil {
+				return err
+			}
+		}
+	}
+	return cursor.Err()
+}
+
+func (m *Repository) insertBuckets(ctx context.Context, routeID uuid.UUID, path []models.GPSData) error {
+	buckets := toBucketDocuments(routeID, path, m.bucketSize)
+	if len(buckets) == 0 {
+		return nil
+	}
+	_, err := m.bucketColl.InsertMany(ctx, buckets)
+	return err
+}
+
+// appendToBucket pushes the point into the route's last bucket, or opens
+// the next one once it is full. The bucket's own count decides where a
+// point goes, so a failed write cannot leave a gap the way a separate
+// counter would; point_count on the route is only a summary. Concurrent
+// writers that open the same bucket collide on the unique (route_id, seq)
+// index and retry.
+func (m *Repository) appendToBucket(ctx context.Context, routeID uuid.UUID, gps models.GPSData) error {
+	point := toPointDocument(gps)
+	res, err := m.routeColl.UpdateOne(ctx,
+		bson.M{"route_id": routeID},
+		bson.M{"$set": bson.M{"last_position": point}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return models.ErrRouteNotFound
+	}
+
+	for attempt := 0; ; attempt++ {
+		seq, err := m.openBucketSeq(ctx, routeID)
+		if err != nil {
+			return err
+		}
+		_, err = m.bucketColl.UpdateOne(ctx,
+			bson.M{"route_id": routeID, "seq": seq, "count": bson.M{"$lt": m.bucketSize}},
+			bson.M{
+				"$push": bson.M{"points": point},
+				"$inc":  bson.M{"count": 1},
+				"$min":  bson.M{"start": gps.Timestamp},
+				"$max":  bson.M{"end": gps.Timestamp},
+			},
+			options.UpdateOne().SetUpsert(true),
+		)
+		if mongo.IsDuplicateKeyError(err) && attempt < maxAppendRetries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	_, err = m.routeColl.UpdateOne(ctx,
+		bson.M{"route_id": routeID},
+		bson.M{"$inc": bson.M{"point_count": 1}},
+	)
+	return err
+}
+
+// openBucketSeq returns the seq of the route's last bucket if it has room,
+// otherwise the seq of the next one.
+func (m *Repository) openBucketSeq(ctx context.Context, routeID uuid.UUID) (int, error) {
+	var last bucketDocument
+	err := m.bucketColl.FindOne(ctx,
+		bson.M{"route_id": routeID},
+		options.FindOne().
+			SetSort(bson.D{{Key: "seq", Value: -1}}).
+			SetProjection(bson.M{"seq": 1, "count": 1}),
+	).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if last.Count < m.bucketSize {
+		return last.Seq, nil
+	}
+	return last.Seq + 1, nil
+}
+
+// replaceBuckets writes the route's buckets in place and then removes any
+// left over from a longer earlier copy. Every bucket is replaced on its own,
+// so a crash part way leaves the old or the new copy of each bucket but
+// never a route without points, and a retry converges.
+func (m *Repository) replaceBuckets(ctx context.Context, routeID uuid.UUID, path []models.GPSData) error {
+	buckets := toBucketDocuments(routeID, path, m.bucketSize)
+	if len(buckets) > 0 {
+		writes := make([]mongo.WriteModel, 0, len(buckets))
+		for _, b := range buckets {
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"route_id": routeID, "seq": b.Seq}).
+				SetReplacement(b).
+				SetUpsert(true))
+		}
+		if _, err := m.bucketColl.BulkWrite(ctx, writes); err != nil {
+			return err
+		}
+	}
+	_, err := m.bucketColl.DeleteMany(ctx, bson.M{"route_id": routeID, "seq": bson.M{"$gte": len(buckets)}})
+	return err
+}
+
+// MigrateEmbeddedPaths moves the path array of routes stored in the old
+// single-document layout into buckets. The legacy points take the negative
+// seqs just below any bucket ingestion may have opened meanwhile, and each
+// bucket is only inserted if missing, so an interrupted run can simply be
+// repeated. The path is dropped in the same update that adds its points to
+// point_count, which happens once per route. Until then GetRouteByID reads
+// only the embedded path.
+func (m *Repository) MigrateEmbeddedPaths(ctx context.Context) (int, error) {
+	cursor, err := m.routeColl.Find(ctx, bson.M{"path": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var doc routeDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return migrated, err
+		}
+		if err := m.migrateEmbeddedPath(ctx, doc); err != nil {
+			return migrated, fmt.Errorf("migrate route %s: %w", doc.RouteID, err)
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+func (m *Repository) migrateEmbeddedPath(ctx context.Context, doc routeDocument) error {
+	path := doc.legacyPath()
+	buckets := toBucketDocuments(doc.RouteID, path, m.bucketSize)
+	if len(buckets) > 0 {
+		// Seq -1 goes first: appendToBucket writes after the highest seq, so
+		// it must never see a legacy bucket above a missing one.
+		writes := make([]mongo.WriteModel, 0, len(buckets))
+		for i := len(buckets) - 1; i >= 0; i-- {
+			b := buckets[i]
+			b.Seq -= len(buckets)
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"route_id": doc.RouteID, "seq": b.Seq}).
+				SetUpdate(bson.M{"$setOnInsert": b}).
+				SetUpsert(true))
+		}
+		if _, err := m.bucketColl.BulkWrite(ctx, writes); err != nil {
+			return err
+		}
+	}
+
+	meta := toRouteDocument(doc.toModel(path))
+	_, err := m.routeColl.UpdateOne(ctx,
+		bson.M{"route_id": doc.RouteID, "path": bson.M{"$exists": true}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"point_count":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$point_count", 0}}, len(path)}},
+				"last_position": bson.M{"$ifNull": bson.A{"$last_position", meta.LastPosition}},
+			}}},
+			{{Key: "$unset", Value: "path"}},
+		},
+	)
+	return err
+}
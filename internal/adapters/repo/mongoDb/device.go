@@ -0,0 +1,104 @@
+package mongoDb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func ensureDeviceCollection(ctx context.Context, db *mongo.Database) (*mongo.Collection, error) {
+	coll := db.Collection("devices")
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"device_id": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"imei": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"owner_id": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+func (m *Repository) CreateDevice(ctx context.Context, device models.Device) error {
+	_, err := m.deviceColl.InsertOne(ctx, device)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.ErrDuplicateDevice
+	}
+	return err
+}
+
+func (m *Repository) GetDevice(ctx context.Context, deviceID uuid.UUID) (models.Device, error) {
+	return m.findDevice(ctx, bson.M{"device_id": deviceID})
+}
+
+func (m *Repository) GetDeviceByIMEI(ctx context.Context, imei string) (models.Device, error) {
+	return m.findDevice(ctx, bson.M{"imei": imei})
+}
+
+func (m *Repository) findDevice(ctx context.Context, filter bson.M) (models.Device, error) {
+	var device models.Device
+	err := m.deviceColl.FindOne(ctx, filter).Decode(&device)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Device{}, models.ErrDeviceNotFound
+	}
+	if err != nil {
+		return models.Device{}, err
+	}
+	return device, nil
+}
+
+func (m *Repository) ListDevices(ctx context.Context) ([]models.Device, error) {
+	cursor, err := m.deviceColl.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "imei", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	devices := []models.Device{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (m *Repository) UpdateDevice(ctx context.Context, device models.Device) error {
+	return m.updateDevice(ctx, device.DeviceID, bson.M{
+		"owner_id":   device.OwnerID,
+		"vehicle_id": device.VehicleID,
+		"protocol":   device.Protocol,
+	})
+}
+
+func (m *Repository) SetDeviceKey(ctx context.Context, deviceID uuid.UUID, keyHash string) error {
+	return m.updateDevice(ctx, deviceID, bson.M{"key_hash": keyHash})
+}
+
+func (m *Repository) updateDevice(ctx context.Context, deviceID uuid.UUID, set bson.M) error {
+	set["updated_at"] = time.Now().UTC()
+	res, err := m.deviceColl.UpdateOne(ctx, bson.M{"device_id": deviceID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return models.ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (m *Repository) DeleteDevice(ctx context.Context, deviceID uuid.UUID) error {
+	res, err := m.deviceColl.DeleteOne(ctx, bson.M{"device_id": deviceID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return models.ErrDeviceNotFound
+	}
+	return nil
+}
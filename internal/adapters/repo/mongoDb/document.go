@@ -0,0 +1,140 @@
+package mongoDb
+
+import (
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// geoPoint is a GeoJSON point. MongoDB expects coordinates in
+// [longitude, latitude] order; altitude stays in the location field.
+type geoPoint struct {
+	Type        string    `bson:"type"`
+	Coordinates []float64 `bson:"coordinates"`
+}
+
+type geoPolygon struct {
+	Type        string        `bson:"type"`
+	Coordinates [][][]float64 `bson:"coordinates"`
+}
+
+type pointDocument struct {
+	Location  models.Location `bson:"location"`
+	Geo       geoPoint        `bson:"geo"`
+	Timestamp time.Time       `bson:"timestamp"`
+}
+
+// routeDocument holds route metadata; the points live in route_buckets.
+type routeDocument struct {
+	RouteID      uuid.UUID      `bson:"route_id"`
+	OwnerID      uuid.UUID      `bson:"owner_id,omitempty"`
+	StartTime    time.Time      `bson:"start_time"`
+	Finished     bool           `bson:"finished"`
+	EndTime      time.Time      `bson:"end_time,omitempty"`
+	LastPosition *pointDocument `bson:"last_position,omitempty"`
+	PointCount   int            `bson:"point_count"`
+	// Path is only present on routes written before the bucket layout and
+	// is removed by MigrateEmbeddedPaths.
+	Path []pointDocument `bson:"path,omitempty"`
+}
+
+// bucketDocument holds up to the repository's bucket size consecutive
+// points of one route. Seq orders the buckets of a route.
+type bucketDocument struct {
+	RouteID uuid.UUID       `bson:"route_id"`
+	Seq     int             `bson:"seq"`
+	Start   time.Time       `bson:"start"`
+	End     time.Time       `bson:"end"`
+	Count   int             `bson:"count"`
+	Points  []pointDocument `bson:"points"`
+}
+
+func newGeoPoint(loc models.Location) geoPoint {
+	return geoPoint{Type: "Point", Coordinates: []float64{loc.Longitude, loc.Latitude}}
+}
+
+func newGeoPolygon(ring []models.Location) geoPolygon {
+	coords := make([][]float64, 0, len(ring)+1)
+	for _, loc := range ring {
+		coords = append(coords, []float64{loc.Longitude, loc.Latitude})
+	}
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		coords = append(coords, []float64{ring[0].Longitude, ring[0].Latitude})
+	}
+	return geoPolygon{Type: "Polygon", Coordinates: [][][]float64{coords}}
+}
+
+func toPointDocument(gps models.GPSData) pointDocument {
+	return pointDocument{
+		Location:  gps.Location,
+		Geo:       newGeoPoint(gps.Location),
+		Timestamp: gps.Timestamp,
+	}
+}
+
+func (p pointDocument) toModel() models.GPSData {
+	return models.GPSData{Location: p.Location, Timestamp: p.Timestamp}
+}
+
+func toRouteDocument(route models.Route) routeDocument {
+	doc := routeDocument{
+		RouteID:    route.RouteID,
+		OwnerID:    route.OwnerID,
+		StartTime:  route.StartTime,
+		Finished:   route.Finished,
+		EndTime:    route.EndTime,
+		PointCount: len(route.Path),
+	}
+	if len(route.Path) > 0 {
+		last := toPointDocument(route.Path[len(route.Path)-1])
+		doc.LastPosition = &last
+	}
+	return doc
+}
+
+func toBucketDocuments(routeID uuid.UUID, path []models.GPSData, size int) []bucketDocument {
+	buckets := make([]bucketDocument, 0, (len(path)+size-1)/size)
+	for start := 0; start < len(path); start += size {
+		end := min(start+size, len(path))
+		bucket := bucketDocument{
+			RouteID: routeID,
+			Seq:     start / size,
+			Start:   path[start].Timestamp,
+			End:     path[start].Timestamp,
+			Count:   end - start,
+			Points:  make([]pointDocument, 0, end-start),
+		}
+		for _, gps := range path[start:end] {
+			bucket.Points = append(bucket.Points, toPointDocument(gps))
+			if gps.Timestamp.Before(bucket.Start) {
+				bucket.Start = gps.Timestamp
+			}
+			if gps.Timestamp.After(bucket.End) {
+				bucket.End = gps.Timestamp
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+func (d routeDocument) toModel(path []models.GPSData) models.Route {
+	return models.Route{
+		RouteID:   d.RouteID,
+		OwnerID:   d.OwnerID,
+		Path:      path,
+		StartTime: d.StartTime,
+		Finished:  d.Finished,
+		EndTime:   d.EndTime,
+	}
+}
+
+func (d routeDocument) legacyPath() []models.GPSData {
+	path := make([]models.GPSData, 0, len(d.Path))
+	for _, p := range d.Path {
+		path = append(path, p.toModel())
+	}
+	return path
+}
@@ -0,0 +1,83 @@
+package mongoDb
+
+import (
+	"context"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func ensureGeofenceCollections(ctx context.Context, db *mongo.Database) (*mongo.Collection, *mongo.Collection, error) {
+	fenceColl := db.Collection("geofences")
+	_, err := fenceColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"fence_id": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eventColl := db.Collection("geofence_events")
+	_, err = eventColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "fence_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "device_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fenceColl, eventColl, nil
+}
+
+func (m *Repository) CreateGeofence(ctx context.Context, fence models.Geofence) error {
+	_, err := m.fenceColl.InsertOne(ctx, fence)
+	return err
+}
+
+func (m *Repository) ListGeofences(ctx context.Context) ([]models.Geofence, error) {
+	cursor, err := m.fenceColl.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var fences []models.Geofence
+	if err := cursor.All(ctx, &fences); err != nil {
+		return nil, err
+	}
+	return fences, nil
+}
+
+func (m *Repository) DeleteGeofence(ctx context.Context, fenceID uuid.UUID) error {
+	_, err := m.fenceColl.DeleteOne(ctx, bson.M{"fence_id": fenceID})
+	return err
+}
+
+func (m *Repository) StoreGeofenceEvents(ctx context.Context, events []models.GeofenceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	_, err := m.fenceEventColl.InsertMany(ctx, events)
+	return err
+}
+
+func (m *Repository) GetGeofenceEvents(ctx context.Context, fenceID uuid.UUID, limit int) ([]models.GeofenceEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := m.fenceEventColl.Find(ctx, bson.M{"fence_id": fenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []models.GeofenceEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -2,7 +2,8 @@ package mongoDb
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"gps/internal/domain/interfaces"
 	"gps/internal/domain/models"
 	"time"
 
@@ -12,109 +13,256 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+var (
+	_ interfaces.RouteRepository        = (*Repository)(nil)
+	_ interfaces.UserRepository         = (*Repository)(nil)
+	_ interfaces.SpatialRouteRepository = (*Repository)(nil)
+	_ interfaces.GeofenceRepository     = (*Repository)(nil)
+	_ interfaces.RollupRepository       = (*Repository)(nil)
+	_ interfaces.RouteArchive           = (*Repository)(nil)
+	_ interfaces.ShareRepository        = (*Repository)(nil)
+	_ interfaces.RefreshTokenRepository = (*Repository)(nil)
+	_ interfaces.DeviceRepository       = (*Repository)(nil)
+)
+
 type Repository struct {
-	client    *mongo.Client
-	db        *mongo.Database
-	routeColl *mongo.Collection
-	usersColl *mongo.Collection
-	ctx       context.Context
+	client         *mongo.Client
+	db             *mongo.Database
+	routeColl      *mongo.Collection
+	usersColl      *mongo.Collection
+	fenceColl      *mongo.Collection
+	fenceEventColl *mongo.Collection
+	rollupColl     *mongo.Collection
+	bucketColl     *mongo.Collection
+	shareColl      *mongo.Collection
+	linkColl       *mongo.Collection
+	refreshColl    *mongo.Collection
+	deviceColl     *mongo.Collection
+	bucketSize     int
 }
 
-func NewRepository(ctx context.Context, client *mongo.Client, dbName string) (*Repository, error) {
+type RepositoryOption func(*Repository)
+
+// WithBucketSize sets how many points are stored per route bucket document.
+func WithBucketSize(size int) RepositoryOption {
+	return func(r *Repository) {
+		if size > 0 {
+			r.bucketSize = size
+		}
+	}
+}
+
+// NewRepository uses ctx only to create indexes and collections; every
+// method takes its own context.
+func NewRepository(ctx context.Context, client *mongo.Client, dbName string, opts ...RepositoryOption) (*Repository, error) {
 
 	db := client.Database(dbName)
 
 	coll := db.Collection("routes")
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"route_id": 1},
-		Options: options.Index().SetUnique(true),
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"route_id": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.M{"last_position.geo": "2dsphere"}},
+		{Keys: bson.M{"owner_id": 1}},
 	}
-	_, err := coll.Indexes().CreateOne(ctx, indexModel)
+	_, err := coll.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
 		return nil, err
 	}
-	return &Repository{
-		client:    client,
-		db:        db,
-		routeColl: coll,
-		usersColl: db.Collection("users"),
-		ctx:       ctx,
-	}, nil
-}
 
-func (m *Repository) CreateRoute(route models.Route) (*mongo.InsertOneResult, error) {
-	return m.routeColl.InsertOne(m.ctx, route)
-}
+	usersColl := db.Collection("users")
+	_, err = usersColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"id": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"username": 1}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return nil, err
+	}
 
-func (m *Repository) GetRouteByID(routeID uuid.UUID) (*models.Route, error) {
-	var route models.Route
-	err := m.routeColl.FindOne(m.ctx, bson.M{"route_id": routeID}).Decode(&route)
+	fenceColl, fenceEventColl, err := ensureGeofenceCollections(ctx, db)
 	if err != nil {
 		return nil, err
 	}
-	return &route, nil
+	rollupColl, err := ensureRollupCollection(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	bucketColl, err := ensureBucketCollection(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	shareColl, linkColl, err := ensureShareCollections(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	refreshColl, err := ensureRefreshTokenCollection(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	deviceColl, err := ensureDeviceCollection(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	repo := &Repository{
+		client:         client,
+		db:             db,
+		routeColl:      coll,
+		usersColl:      usersColl,
+		fenceColl:      fenceColl,
+		fenceEventColl: fenceEventColl,
+		rollupColl:     rollupColl,
+		bucketColl:     bucketColl,
+		shareColl:      shareColl,
+		linkColl:       linkColl,
+		refreshColl:    refreshColl,
+		deviceColl:     deviceColl,
+		bucketSize:     defaultBucketSize,
+	}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo, nil
+}
+
+func (m *Repository) CreateRoute(ctx context.Context, route models.Route) error {
+	_, err := m.routeColl.InsertOne(ctx, toRouteDocument(route))
+	if mongo.IsDuplicateKeyError(err) {
+		return models.ErrDuplicateRoute
+	}
+	if err != nil {
+		return err
+	}
+	return m.insertBuckets(ctx, route.RouteID, route.Path)
 }
 
-func (m *Repository) GetGPSDataLastNSeconds(n int) ([]models.GPSData, error) {
-	since := time.Now().Add(-time.Duration(n) * time.Second)
-	cursor, err := m.routeColl.Find(m.ctx, bson.M{
-		"path.timestamp": bson.M{"$gte": since},
+// UpsertRoute replaces the stored route with the same id or inserts it, so
+// archiving the same route twice is harmless. The buckets are written before
+// the metadata, so an interrupted upsert is repaired by the next one.
+func (m *Repository) UpsertRoute(ctx context.Context, route models.Route) error {
+	if err := m.replaceBuckets(ctx, route.RouteID, route.Path); err != nil {
+		return err
+	}
+	_, err := m.routeColl.ReplaceOne(ctx, bson.M{"route_id": route.RouteID}, toRouteDocument(route), options.Replace().SetUpsert(true))
+	return err
+}
+
+// FinishArchivedRoute marks an archived route finished for trips that end
+// after their live copy expired.
+func (m *Repository) FinishArchivedRoute(ctx context.Context, routeID uuid.UUID, endTime time.Time) error {
+	res, err := m.routeColl.UpdateOne(ctx, bson.M{"route_id": routeID}, bson.M{
+		"$set": bson.M{"finished": true, "end_time": endTime},
 	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return models.ErrRouteNotFound
 	}
-	defer cursor.Close(m.ctx)
-	var result []models.GPSData
+	return nil
+}
 
-	for cursor.Next(m.ctx) {
-		var route models.Route
-		if err := cursor.Decode(&route); err != nil {
-			return nil, err
-		}
+func (m *Repository) GetRouteByID(ctx context.Context, routeID uuid.UUID) (models.Route, error) {
+	var doc routeDocument
+	err := m.routeColl.FindOne(ctx, bson.M{"route_id": routeID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Route{}, models.ErrRouteNotFound
+	}
+	if err != nil {
+		return models.Route{}, err
+	}
+	if doc.Path != nil {
+		return doc.toModel(doc.legacyPath()), nil
+	}
 
-		for _, gps := range route.Path {
-			if gps.Timestamp.After(since) || gps.Timestamp.Equal(since) {
-				result = append(result, gps)
-			}
-		}
+	path := make([]models.GPSData, 0, doc.PointCount)
+	err = m.StreamRoutePath(ctx, routeID, func(gps models.GPSData) error {
+		path = append(path, gps)
+		return nil
+	})
+	if err != nil {
+		return models.Route{}, err
 	}
+	return doc.toModel(path), nil
+}
 
+func (m *Repository) GetGPSDataLastNSeconds(ctx context.Context, seconds int) ([]models.GPSData, error) {
+	since := time.Now().Add(-time.Duration(seconds) * time.Second)
+	positions, err := m.GetPointsSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.GPSData, 0, len(positions))
+	for _, p := range positions {
+		result = append(result, p.GPSData)
+	}
 	return result, nil
 }
 
-func (m *Repository) AddGPSDataToRoute(routeID uuid.UUID, gps models.GPSData) (*mongo.UpdateResult, error) {
-	update := bson.M{
-		"$push": bson.M{"path": gps},
-	}
-	return m.routeColl.UpdateOne(m.ctx, bson.M{"route_id": routeID}, update)
+func (m *Repository) AddGPSDataToRoute(ctx context.Context, routeID uuid.UUID, gps models.GPSData) error {
+	return m.appendToBucket(ctx, routeID, gps)
 }
 
-func (m *Repository) Close() error {
-	return m.client.Disconnect(m.ctx)
+func (m *Repository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
 }
 
-func (m *Repository) CreateUser(username, email, passwordHash string) (uuid.UUID, error) {
+func (m *Repository) CreateUser(ctx context.Context, username, passwordHash string, roles []models.Role) (uuid.UUID, error) {
 	id := uuid.New()
 	user := models.User{
 		UserID:       id,
 		Username:     username,
 		PasswordHash: passwordHash,
+		Roles:        roles,
+	}
+	_, err := m.usersColl.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return uuid.Nil, models.ErrDuplicateUsername
 	}
-	_, err := m.usersColl.InsertOne(m.ctx, user)
 	if err != nil {
 		return uuid.Nil, err
 	}
 	return id, nil
 }
 
-func (m *Repository) GetUserByUsername(username string) (models.User, error) {
+func (m *Repository) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
 	var user models.User
-	err := m.usersColl.FindOne(m.ctx, bson.M{"username": username}).Decode(&user)
+	err := m.usersColl.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, models.ErrUserNotFound
+	}
 	if err != nil {
 		return models.User{}, err
 	}
 	if user.UserID == uuid.Nil {
-		return models.User{}, fmt.Errorf("user not found")
+		return models.User{}, models.ErrUserNotFound
 	}
 	return user, nil
 }
+
+func (m *Repository) GetUserByID(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	var user models.User
+	err := m.usersColl.FindOne(ctx, bson.M{"id": userID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, models.ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (m *Repository) UpdateUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) error {
+	res, err := m.usersColl.UpdateOne(ctx,
+		bson.M{"id": userID},
+		bson.M{"$set": bson.M{"roles": roles, "permissions": permissions}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
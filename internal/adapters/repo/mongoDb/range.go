@@ -0,0 +1,200 @@
+package mongoDb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// rangePoint is one unwound bucket point as produced by the range pipelines.
+type rangePoint struct {
+	RouteID uuid.UUID     `bson:"route_id"`
+	Point   pointDocument `bson:"point"`
+}
+
+// GetRoutePathRange returns the points of a route with from <= timestamp <= to.
+// Only buckets whose [start, end] overlaps the range are read. Routes still
+// using the embedded path layout are not covered; MigrateEmbeddedPaths moves
+// them into buckets.
+func (m *Repository) GetRoutePathRange(ctx context.Context, routeID uuid.UUID, from, to time.Time) ([]models.GPSData, error) {
+	match := bson.M{"route_id": routeID}
+	if !from.IsZero() {
+		match["end"] = bson.M{"$gte": from}
+	}
+	if !to.IsZero() {
+		match["start"] = bson.M{"$lte": to}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "seq", Value: 1}}}},
+	}
+	pipeline = append(pipeline, unwindPoints(from, to)...)
+
+	points, err := m.aggregatePoints(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	path := make([]models.GPSData, 0, len(points))
+	for _, p := range points {
+		path = append(path, p.Point.toModel())
+	}
+	return path, nil
+}
+
+// GetPointsSince returns every point with timestamp >= since across all
+// routes, using the bucket end index to skip buckets that closed earlier.
+func (m *Repository) GetPointsSince(ctx context.Context, since time.Time) ([]models.RoutePosition, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"end": bson.M{"$gte": since}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "route_id", Value: 1}, {Key: "seq", Value: 1}}}},
+	}
+	pipeline = append(pipeline, unwindPoints(since, time.Time{})...)
+
+	points, err := m.aggregatePoints(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.RoutePosition, 0, len(points))
+	for _, p := range points {
+		result = append(result, models.RoutePosition{RouteID: p.RouteID, GPSData: p.Point.toModel()})
+	}
+	return result, nil
+}
+
+// unwindPoints flattens bucket points into {route_id, point} documents and
+// keeps only those inside [from, to].
+func unwindPoints(from, to time.Time) mongo.Pipeline {
+	ts := bson.M{}
+	if !from.IsZero() {
+		ts["$gte"] = from
+	}
+	if !to.IsZero() {
+		ts["$lte"] = to
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{"_id": 0, "route_id": 1, "point": "$points"}}},
+		{{Key: "$unwind", Value: "$point"}},
+	}
+	if len(ts) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"point.timestamp": ts}}})
+	}
+	return pipeline
+}
+
+func (m *Repository) aggregatePoints(ctx context.Context, pipeline mongo.Pipeline) ([]rangePoint, error) {
+	cursor, err := m.bucketColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var points []rangePoint
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// pagePoint is a bucket point with its position in the route, the tie
+// breaker for points with equal timestamps.
+type pagePoint struct {
+	point models.GPSData
+	seq   int
+	index int
+}
+
+// GetRoutePathPage returns up to limit points after the cursor, ordered by
+// timestamp and then by their position in the route, so points appended out
+// of order are not lost between pages. Buckets that end at or after the
+// cursor are read in start order, and only until the points gathered so far
+// precede every unread bucket; a page reads about limit/bucket size buckets
+// however deep into the route it starts.
+func (m *Repository) GetRoutePathPage(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error) {
+	if limit <= 0 {
+		return models.PathPage{}, fmt.Errorf("limit must be positive")
+	}
+
+	filter := bson.M{"route_id": routeID}
+	if !after.Timestamp.IsZero() {
+		filter["end"] = bson.M{"$gte": after.Timestamp}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "seq", Value: 1}})
+	cursor, err := m.bucketColl.Find(ctx, filter, opts)
+	if err != nil {
+		return models.PathPage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	need := after.Skip + limit + 1
+	var points []pagePoint
+	for cursor.Next(ctx) {
+		var bucket bucketDocument
+		if err := cursor.Decode(&bucket); err != nil {
+			return models.PathPage{}, err
+		}
+		if countBefore(points, bucket.Start) >= need {
+			break
+		}
+		for i, p := range bucket.Points {
+			if p.Timestamp.Before(after.Timestamp) {
+				continue
+			}
+			points = append(points, pagePoint{point: p.toModel(), seq: bucket.Seq, index: i})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return models.PathPage{}, err
+	}
+
+	if len(points) == 0 {
+		n, err := m.routeColl.CountDocuments(ctx, bson.M{"route_id": routeID}, options.Count().SetLimit(1))
+		if err != nil {
+			return models.PathPage{}, err
+		}
+		if n == 0 {
+			return models.PathPage{}, models.ErrRouteNotFound
+		}
+		return models.PathPage{Points: []models.GPSData{}}, nil
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		a, b := points[i], points[j]
+		if !a.point.Timestamp.Equal(b.point.Timestamp) {
+			return a.point.Timestamp.Before(b.point.Timestamp)
+		}
+		if a.seq != b.seq {
+			return a.seq < b.seq
+		}
+		return a.index < b.index
+	})
+	start := min(after.Skip, len(points))
+	end := min(start+limit+1, len(points))
+	path := make([]models.GPSData, 0, end-start)
+	for _, p := range points[start:end] {
+		path = append(path, p.point)
+	}
+	return models.NewPathPage(path, limit, after), nil
+}
+
+// countBefore counts the points earlier than start. Every unread bucket
+// begins at or after start, so these points sort ahead of all of them; a
+// point at exactly start may still be preceded by one from a lower seq.
+func countBefore(points []pagePoint, start time.Time) int {
+	n := 0
+	for _, p := range points {
+		if p.point.Timestamp.Before(start) {
+			n++
+		}
+	}
+	return n
+}
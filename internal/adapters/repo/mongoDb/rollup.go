@@ -0,0 +1,156 @@
+package mongoDb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	rollupCollection    = "fleet_rollups"
+	namespaceExistsCode = 48
+)
+
+// ensureRollupCollection creates the time-series collection on first start.
+func ensureRollupCollection(ctx context.Context, db *mongo.Database) (*mongo.Collection, error) {
+	tsOpts := options.TimeSeries().
+		SetTimeField("bucket_start").
+		SetMetaField("meta").
+		SetGranularity("minutes")
+	err := db.CreateCollection(ctx, rollupCollection, options.CreateCollection().SetTimeSeriesOptions(tsOpts))
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.HasErrorCode(namespaceExistsCode)) {
+		return nil, err
+	}
+	return db.Collection(rollupCollection), nil
+}
+
+// StoreRollups inserts in order, so after a write error the rollups before
+// the failed one are stored and the rest are not. Any other error counts
+// none as stored.
+func (m *Repository) StoreRollups(ctx context.Context, rollups []models.Rollup) (int, error) {
+	if len(rollups) == 0 {
+		return 0, nil
+	}
+	_, err := m.rollupColl.InsertMany(ctx, rollups, options.InsertMany().SetOrdered(true))
+	if err == nil {
+		return len(rollups), nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		return bulkErr.WriteErrors[0].Index, err
+	}
+	return 0, err
+}
+
+type rollupRow struct {
+	ID struct {
+		Bucket bson.DateTime `bson:"bucket"`
+		Group  bson.RawValue `bson:"group"`
+	} `bson:"_id"`
+	Distance      float64 `bson:"distance"`
+	Points        int     `bson:"points"`
+	MovingSeconds float64 `bson:"moving_seconds"`
+	MaxSpeed      float64 `bson:"max_speed"`
+}
+
+// QueryRollups re-buckets the stored minute rollups into q.BucketSize
+// buckets aligned to the Unix epoch and groups them by device, route or
+// user.
+func (m *Repository) QueryRollups(ctx context.Context, q models.RollupQuery) ([]models.RollupResult, error) {
+	groupField, err := rollupGroupField(q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	if q.BucketSize.Milliseconds() <= 0 {
+		return nil, fmt.Errorf("%w: bucket size must be at least 1ms", models.ErrInvalidRollupQuery)
+	}
+
+	match := bson.M{"bucket_start": bson.M{"$gte": q.From, "$lt": q.To}}
+	if q.DeviceID != "" {
+		match["meta.device_id"] = q.DeviceID
+	}
+	if q.RouteID != uuid.Nil {
+		match["meta.route_id"] = q.RouteID
+	}
+	if q.UserID != uuid.Nil {
+		match["meta.user_id"] = q.UserID
+	}
+
+	millis := bson.M{"$toLong": "$bucket_start"}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"bucket": bson.M{"$toDate": bson.M{"$subtract": bson.A{millis, bson.M{"$mod": bson.A{millis, q.BucketSize.Milliseconds()}}}}},
+				"group":  "$" + groupField,
+			},
+			"distance":       bson.M{"$sum": "$distance"},
+			"points":         bson.M{"$sum": "$points"},
+			"moving_seconds": bson.M{"$sum": "$moving_seconds"},
+			"max_speed":      bson.M{"$max": "$max_speed"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.bucket", Value: 1}, {Key: "_id.group", Value: 1}}}},
+	}
+
+	cursor, err := m.rollupColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []models.RollupResult
+	for cursor.Next(ctx) {
+		var row rollupRow
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		group, err := rollupGroupValue(q.GroupBy, row.ID.Group)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, models.RollupResult{
+			BucketStart:   row.ID.Bucket.Time(),
+			Group:         group,
+			Distance:      row.Distance,
+			Points:        row.Points,
+			MovingSeconds: row.MovingSeconds,
+			MaxSpeed:      row.MaxSpeed,
+		})
+	}
+	return results, cursor.Err()
+}
+
+func rollupGroupField(groupBy models.RollupGroupBy) (string, error) {
+	switch groupBy {
+	case models.GroupByDevice, "":
+		return "meta.device_id", nil
+	case models.GroupByRoute:
+		return "meta.route_id", nil
+	case models.GroupByUser:
+		return "meta.user_id", nil
+	default:
+		return "", fmt.Errorf("%w: unknown group by %q", models.ErrInvalidRollupQuery, groupBy)
+	}
+}
+
+func rollupGroupValue(groupBy models.RollupGroupBy, raw bson.RawValue) (string, error) {
+	if raw.IsZero() || raw.Type == bson.TypeNull {
+		return "", nil
+	}
+	if groupBy == models.GroupByDevice || groupBy == "" {
+		return raw.StringValue(), nil
+	}
+	var id uuid.UUID
+	if err := raw.Unmarshal(&id); err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
@@ -0,0 +1,173 @@
+package mongoDb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ensureShareCollections creates the user share and public link collections.
+// Links carry a TTL index so expired ones are removed by Mongo; reads still
+// check expires_at because the TTL monitor runs only once a minute.
+func ensureShareCollections(ctx context.Context, db *mongo.Database) (*mongo.Collection, *mongo.Collection, error) {
+	shareColl := db.Collection("route_shares")
+	_, err := shareColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "route_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	linkColl := db.Collection("share_links")
+	_, err = linkColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "route_id", Value: 1}, {Key: "link_id", Value: 1}}},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return shareColl, linkColl, nil
+}
+
+// GetRouteOwner returns the owner of an archived route, or uuid.Nil for
+// routes stored without one.
+func (m *Repository) GetRouteOwner(ctx context.Context, routeID uuid.UUID) (uuid.UUID, error) {
+	var doc struct {
+		OwnerID uuid.UUID `bson:"owner_id"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"owner_id": 1})
+	err := m.routeColl.FindOne(ctx, bson.M{"route_id": routeID}, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return uuid.Nil, models.ErrRouteNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return doc.OwnerID, nil
+}
+
+func (m *Repository) ListRouteIDsByOwner(ctx context.Context, ownerID uuid.UUID) ([]uuid.UUID, error) {
+	opts := options.Find().SetProjection(bson.M{"route_id": 1}).SetSort(bson.D{{Key: "start_time", Value: -1}})
+	cursor, err := m.routeColl.Find(ctx, bson.M{"owner_id": ownerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		RouteID uuid.UUID `bson:"route_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(docs))
+	for _, d := range docs {
+		ids = append(ids, d.RouteID)
+	}
+	return ids, nil
+}
+
+// CreateShare is idempotent: sharing a route with the same user twice keeps
+// the first share.
+func (m *Repository) CreateShare(ctx context.Context, share models.RouteShare) error {
+	_, err := m.shareColl.UpdateOne(ctx,
+		bson.M{"route_id": share.RouteID, "user_id": share.UserID},
+		bson.M{"$setOnInsert": share},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *Repository) DeleteShare(ctx context.Context, routeID, userID uuid.UUID) error {
+	res, err := m.shareColl.DeleteOne(ctx, bson.M{"route_id": routeID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return models.ErrShareNotFound
+	}
+	return nil
+}
+
+func (m *Repository) ListShares(ctx context.Context, routeID uuid.UUID) ([]models.RouteShare, error) {
+	cursor, err := m.shareColl.Find(ctx, bson.M{"route_id": routeID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	shares := []models.RouteShare{}
+	if err := cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (m *Repository) HasShare(ctx context.Context, routeID, userID uuid.UUID) (bool, error) {
+	n, err := m.shareColl.CountDocuments(ctx, bson.M{"route_id": routeID, "user_id": userID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (m *Repository) CreateShareLink(ctx context.Context, link models.ShareLink) error {
+	_, err := m.linkColl.InsertOne(ctx, link)
+	return err
+}
+
+// GetShareLinkByHash returns the link for a token hash unless it has expired.
+func (m *Repository) GetShareLinkByHash(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := m.linkColl.FindOne(ctx, bson.M{
+		"token_hash": tokenHash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&link)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.ShareLink{}, models.ErrShareNotFound
+	}
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	return link, nil
+}
+
+func (m *Repository) ListShareLinks(ctx context.Context, routeID uuid.UUID) ([]models.ShareLink, error) {
+	cursor, err := m.linkColl.Find(ctx, bson.M{
+		"route_id":   routeID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	links := []models.ShareLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (m *Repository) DeleteShareLink(ctx context.Context, routeID, linkID uuid.UUID) error {
+	res, err := m.linkColl.DeleteOne(ctx, bson.M{"route_id": routeID, "link_id": linkID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return models.ErrShareNotFound
+	}
+	return nil
+}
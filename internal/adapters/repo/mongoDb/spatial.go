@@ -0,0 +1,120 @@
+package mongoDb
+
+import (
+	"context"
+
+	"gps/internal/domain/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GetRoutesNear returns the metadata of routes with at least one point
+// within maxMeters of loc, closest first. Paths are not loaded.
+func (m *Repository) GetRoutesNear(ctx context.Context, loc models.Location, maxMeters float64) ([]models.Route, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          newGeoPoint(loc),
+			"key":           "points.geo",
+			"maxDistance":   maxMeters,
+			"spherical":     true,
+			"distanceField": "distance",
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$route_id", "distance": bson.M{"$min": "$distance"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "distance", Value: 1}, {Key: "_id", Value: 1}}}},
+	}
+	return m.routesByBucketGroups(ctx, pipeline)
+}
+
+func (m *Repository) GetRoutesInBoundingBox(ctx context.Context, box models.BoundingBox) ([]models.Route, error) {
+	return m.GetRoutesIntersecting(ctx, box.Polygon())
+}
+
+// GetRoutesIntersecting returns the metadata of routes with at least one
+// point inside the polygon. The ring is closed automatically if needed.
+// Paths are not loaded.
+func (m *Repository) GetRoutesIntersecting(ctx context.Context, polygon []models.Location) ([]models.Route, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"points.geo": bson.M{
+				"$geoIntersects": bson.M{
+					"$geometry": newGeoPolygon(polygon),
+				},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$route_id"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	return m.routesByBucketGroups(ctx, pipeline)
+}
+
+// GetLastPositionsNear returns the latest known position of every route that
+// was last seen within maxMeters of loc, closest first.
+func (m *Repository) GetLastPositionsNear(ctx context.Context, loc models.Location, maxMeters float64, limit int) ([]models.RoutePosition, error) {
+	filter := bson.M{
+		"last_position.geo": bson.M{
+			"$nearSphere": bson.M{
+				"$geometry":    newGeoPoint(loc),
+				"$maxDistance": maxMeters,
+			},
+		},
+	}
+	opts := options.Find().SetProjection(bson.M{"route_id": 1, "last_position": 1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := m.routeColl.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []models.RoutePosition
+	for cursor.Next(ctx) {
+		var doc routeDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		if doc.LastPosition == nil {
+			continue
+		}
+		result = append(result, models.RoutePosition{
+			RouteID: doc.RouteID,
+			GPSData: doc.LastPosition.toModel(),
+		})
+	}
+	return result, cursor.Err()
+}
+
+// routesByBucketGroups finishes a bucket pipeline that groups by route id
+// by joining the route metadata in the same query, keeping its order.
+// Routes whose metadata is missing are skipped.
+func (m *Repository) routesByBucketGroups(ctx context.Context, pipeline mongo.Pipeline) ([]models.Route, error) {
+	pipeline = append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         m.routeColl.Name(),
+			"localField":   "_id",
+			"foreignField": "route_id",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"_id": 0, "path": 0}}},
+			"as":           "route",
+		}}},
+		bson.D{{Key: "$unwind", Value: "$route"}},
+		bson.D{{Key: "$replaceWith", Value: "$route"}},
+	)
+	cursor, err := m.bucketColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var routes []models.Route
+	for cursor.Next(ctx) {
+		var doc routeDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		routes = append(routes, doc.toModel(nil))
+	}
+	return routes, cursor.Err()
+}
@@ -0,0 +1,84 @@
+package mongoDb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func ensureRefreshTokenCollection(ctx context.Context, db *mongo.Database) (*mongo.Collection, error) {
+	coll := db.Collection("refresh_tokens")
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"family_id": 1}},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coll, nil
+}
+
+func (m *Repository) StoreRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	_, err := m.refreshColl.InsertOne(ctx, token)
+	return err
+}
+
+func (m *Repository) UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := m.refreshColl.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": tokenHash,
+			"used":       false,
+			"revoked":    false,
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"used": true}},
+	).Decode(&token)
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RefreshToken{}, err
+	}
+
+	// Tell a replayed token apart from an unknown or expired one.
+	err = m.refreshColl.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RefreshToken{}, models.ErrTokenNotFound
+	}
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	if token.Used || token.Revoked {
+		return token, models.ErrTokenReused
+	}
+	return models.RefreshToken{}, models.ErrTokenNotFound
+}
+
+func (m *Repository) GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := m.refreshColl.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.RefreshToken{}, models.ErrTokenNotFound
+	}
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+func (m *Repository) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := m.refreshColl.UpdateMany(ctx,
+		bson.M{"family_id": familyID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	return err
+}
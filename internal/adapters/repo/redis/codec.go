@@ -0,0 +1,123 @@
+package redisRepo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Path members are encoded as a version byte followed by fixed-width
+// big-endian fields: unix nanos (int64), latitude, longitude and altitude
+// (float64). Equal points always encode to the same member, unlike JSON.
+const (
+	pointCodecV1   byte = 1
+	pointV1Size         = 1 + 8 + 3*8
+	legacyJSONByte byte = '{'
+)
+
+func encodePoint(point models.GPSData) []byte {
+	buf := make([]byte, pointV1Size)
+	buf[0] = pointCodecV1
+	binary.BigEndian.PutUint64(buf[1:], uint64(point.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(buf[9:], math.Float64bits(point.Location.Latitude))
+	binary.BigEndian.PutUint64(buf[17:], math.Float64bits(point.Location.Longitude))
+	binary.BigEndian.PutUint64(buf[25:], math.Float64bits(point.Location.Altitude))
+	return buf
+}
+
+// decodePoint reads a v1 member or a legacy JSON member written before the
+// binary codec was introduced.
+func decodePoint(raw []byte) (models.GPSData, error) {
+	if len(raw) == 0 {
+		return models.GPSData{}, fmt.Errorf("empty path member")
+	}
+	switch raw[0] {
+	case pointCodecV1:
+		if len(raw) != pointV1Size {
+			return models.GPSData{}, fmt.Errorf("path member has %d bytes, want %d", len(raw), pointV1Size)
+		}
+		return models.GPSData{
+			Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(raw[1:]))).UTC(),
+			Location: models.Location{
+				Latitude:  math.Float64frombits(binary.BigEndian.Uint64(raw[9:])),
+				Longitude: math.Float64frombits(binary.BigEndian.Uint64(raw[17:])),
+				Altitude:  math.Float64frombits(binary.BigEndian.Uint64(raw[25:])),
+			},
+		}, nil
+	case legacyJSONByte:
+		var point models.GPSData
+		if err := json.Unmarshal(raw, &point); err != nil {
+			return models.GPSData{}, err
+		}
+		return point, nil
+	default:
+		return models.GPSData{}, fmt.Errorf("unknown path member version %d", raw[0])
+	}
+}
+
+// migrateMembersScript swaps legacy members of one path for their binary
+// form. A path that expired in the meantime is left alone instead of being
+// recreated without a TTL, and members another migrator already swapped are
+// skipped. ARGV holds (legacy member, score, binary member) triples.
+var migrateMembersScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local swapped = 0
+for i = 1, #ARGV, 3 do
+	if redis.call('ZREM', KEYS[1], ARGV[i]) == 1 then
+		redis.call('ZADD', KEYS[1], ARGV[i + 1], ARGV[i + 2])
+		swapped = swapped + 1
+	end
+end
+return swapped
+`)
+
+// MigratePointEncoding rewrites legacy JSON path members in the binary
+// format. Members are swapped by one script per route so readers never see
+// a point twice and the path keeps its TTL. It returns how many members
+// were rewritten.
+func (r *Repository) MigratePointEncoding(ctx context.Context) (int, error) {
+	if r == nil || r.client == nil {
+		return 0, fmt.Errorf("redis repository is not initialized")
+	}
+
+	migrated := 0
+	iter := r.client.Scan(ctx, 0, routeKeyPrefix+"*"+routePathSuffix, 100).Iterator()
+	for iter.Next(ctx) {
+		pathKey := iter.Val()
+		members, err := r.client.ZRangeWithScores(ctx, pathKey, 0, -1).Result()
+		if err != nil {
+			return migrated, err
+		}
+
+		var args []any
+		for _, z := range members {
+			raw, ok := z.Member.(string)
+			if !ok || raw == "" || raw[0] != legacyJSONByte {
+				continue
+			}
+			point, err := decodePoint([]byte(raw))
+			if err != nil {
+				return migrated, err
+			}
+			args = append(args, raw, z.Score, encodePoint(point))
+		}
+		if len(args) == 0 {
+			continue
+		}
+		swapped, err := migrateMembersScript.Run(ctx, r.client, []string{pathKey}, args...).Int()
+		if err != nil {
+			return migrated, err
+		}
+		migrated += swapped
+	}
+	return migrated, iter.Err()
+}
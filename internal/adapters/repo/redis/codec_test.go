@@ -0,0 +1,111 @@
+package redisRepo
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+func samplePoint() models.GPSData {
+	return models.GPSData{
+		Location:  models.Location{Latitude: 43.238949, Longitude: 76.889709, Altitude: 812.5},
+		Timestamp: time.Date(2025, 3, 14, 9, 26, 53, 589793238, time.UTC),
+	}
+}
+
+func TestPointCodecRoundTrip(t *testing.T) {
+	point := samplePoint()
+	raw := encodePoint(point)
+	if len(raw) != pointV1Size || raw[0] != pointCodecV1 {
+		t.Fatalf("unexpected encoding: %d bytes, version %d", len(raw), raw[0])
+	}
+	got, err := decodePoint(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Location != point.Location || !got.Timestamp.Equal(point.Timestamp) {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, point)
+	}
+}
+
+func TestPointCodecIsCanonical(t *testing.T) {
+	a := samplePoint()
+	b := a
+	b.Timestamp = a.Timestamp.In(time.FixedZone("ALMT", 5*60*60))
+	if !bytes.Equal(encodePoint(a), encodePoint(b)) {
+		t.Fatal("same instant in different zones encoded differently")
+	}
+}
+
+func TestDecodeLegacyJSON(t *testing.T) {
+	point := samplePoint()
+	raw, err := json.Marshal(point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodePoint(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Location != point.Location || !got.Timestamp.Equal(point.Timestamp) {
+		t.Fatalf("legacy decode mismatch: got %+v, want %+v", got, point)
+	}
+}
+
+func TestDecodeRejectsUnknownVersion(t *testing.T) {
+	raw := encodePoint(samplePoint())
+	raw[0] = 0x7f
+	if _, err := decodePoint(raw); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+	if _, err := decodePoint(raw[:10]); err == nil {
+		t.Fatal("expected error for truncated member")
+	}
+}
+
+// The member-bytes metric approximates per-point memory in the ZSET; Redis
+// overhead per member is the same for both formats.
+func BenchmarkPointEncode(b *testing.B) {
+	point := samplePoint()
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		var raw []byte
+		for i := 0; i < b.N; i++ {
+			raw = encodePoint(point)
+		}
+		b.ReportMetric(float64(len(raw)), "member-bytes")
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		var raw []byte
+		for i := 0; i < b.N; i++ {
+			raw, _ = json.Marshal(point)
+		}
+		b.ReportMetric(float64(len(raw)), "member-bytes")
+	})
+}
+
+func BenchmarkPointDecode(b *testing.B) {
+	point := samplePoint()
+	binaryRaw := encodePoint(point)
+	jsonRaw, _ := json.Marshal(point)
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodePoint(binaryRaw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodePoint(jsonRaw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
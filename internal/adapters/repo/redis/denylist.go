@@ -0,0 +1,43 @@
+package redisRepo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gps/internal/domain/interfaces"
+)
+
+const denylistPrefix = "jwt:deny:"
+
+var _ interfaces.TokenDenylist = (*Repository)(nil)
+
+// DenyToken blocks an access token by its jti until it would have expired
+// anyway, after which the key expires with it.
+func (r *Repository) DenyToken(ctx context.Context, jti string, until time.Time) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	if jti == "" {
+		return fmt.Errorf("jti is required")
+	}
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.client.Set(ctx, denylistPrefix+jti, 1, ttl).Err()
+}
+
+func (r *Repository) IsTokenDenied(ctx context.Context, jti string) (bool, error) {
+	if r == nil || r.client == nil {
+		return false, fmt.Errorf("redis repository is not initialized")
+	}
+	if jti == "" {
+		return false, nil
+	}
+	n, err := r.client.Exists(ctx, denylistPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,58 @@
+package redisRepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gps/internal/domain/interfaces"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyPrefix = "idem:"
+
+var _ interfaces.IdempotencyStore = (*Repository)(nil)
+
+// ReserveIdempotencyKey stores an empty value as the in-flight claim; a
+// completed response is never empty.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, key string, ttl time.Duration) ([]byte, bool, error) {
+	if r == nil || r.client == nil {
+		return nil, false, fmt.Errorf("redis repository is not initialized")
+	}
+	ok, err := r.client.SetNX(ctx, idempotencyPrefix+key, "", ttl).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return nil, true, nil
+	}
+	response, err := r.client.Get(ctx, idempotencyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The claim expired in between; report it as in flight and let the
+		// client retry.
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return response, false, nil
+}
+
+func (r *Repository) CompleteIdempotencyKey(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	if len(response) == 0 {
+		return fmt.Errorf("idempotent response is empty")
+	}
+	return r.client.Set(ctx, idempotencyPrefix+key, response, ttl).Err()
+}
+
+func (r *Repository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	return r.client.Del(ctx, idempotencyPrefix+key).Err()
+}
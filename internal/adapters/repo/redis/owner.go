@@ -0,0 +1,130 @@
+package redisRepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const ownerIndexPrefix = "owner:"
+
+// markOwned adds the route to its owner's index, scored by creation time.
+func markOwned(ctx context.Context, pipe redis.Pipeliner, ownerID, routeID uuid.UUID) {
+	pipe.ZAdd(ctx, ownerIndexKey(ownerID), redis.Z{Score: float64(time.Now().UnixNano()), Member: routeID.String()})
+}
+
+// setOwnerScript records the owner of a route that still exists; like
+// finishRouteScript it never recreates an expired route.
+var setOwnerScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// SetRouteOwner assigns a live route to ownerID, e.g. when a trip opens a
+// route for a registered device.
+func (r *Repository) SetRouteOwner(ctx context.Context, routeID, ownerID uuid.UUID) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil || ownerID == uuid.Nil {
+		return fmt.Errorf("route id and owner id are required")
+	}
+	keys := []string{routeMetaKey(routeID), routePathKey(routeID), ownerIndexKey(ownerID)}
+	ok, err := setOwnerScript.Run(ctx, r.client, keys,
+		ownerField, ownerID.String(), time.Now().UnixNano(), routeID.String(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrRouteNotFound
+	}
+	return nil
+}
+
+// GetRouteOwner returns the owner of a live route, or uuid.Nil for routes
+// stored without one.
+func (r *Repository) GetRouteOwner(ctx context.Context, routeID uuid.UUID) (uuid.UUID, error) {
+	if r == nil || r.client == nil {
+		return uuid.Nil, fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return uuid.Nil, fmt.Errorf("route id is required")
+	}
+	exists, err := r.client.Exists(ctx, routeMetaKey(routeID), routePathKey(routeID)).Result()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if exists == 0 {
+		return uuid.Nil, ErrRouteNotFound
+	}
+	return r.readOwner(ctx, routeID)
+}
+
+// ListRouteIDsByOwner returns the owner's routes that are still live and
+// drops index entries whose route has expired or been deleted.
+func (r *Repository) ListRouteIDsByOwner(ctx context.Context, ownerID uuid.UUID) ([]uuid.UUID, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis repository is not initialized")
+	}
+	key := ownerIndexKey(ownerID)
+	members, err := r.client.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(members))
+	cmds := make([]*redis.IntCmd, 0, len(members))
+	pipe := r.client.Pipeline()
+	for _, member := range members {
+		id, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+		cmds = append(cmds, pipe.Exists(ctx, routeMetaKey(id), routePathKey(id)))
+	}
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	live := ids[:0]
+	var gone []any
+	for i, cmd := range cmds {
+		if cmd.Val() == 0 {
+			gone = append(gone, ids[i].String())
+			continue
+		}
+		live = append(live, ids[i])
+	}
+	if len(gone) > 0 {
+		r.client.ZRem(ctx, key, gone...)
+	}
+	return live, nil
+}
+
+func (r *Repository) readOwner(ctx context.Context, routeID uuid.UUID) (uuid.UUID, error) {
+	raw, err := r.client.HGet(ctx, routeMetaKey(routeID), ownerField).Result()
+	if errors.Is(err, redis.Nil) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(raw)
+}
+
+func ownerIndexKey(ownerID uuid.UUID) string {
+	return ownerIndexPrefix + ownerID.String() + ":routes"
+}
@@ -0,0 +1,158 @@
+package redisRepo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// markActive records the last write time of a route so fleet-wide reads
+// only touch routes that changed recently.
+func markActive(ctx context.Context, pipe redis.Pipeliner, routeID uuid.UUID) {
+	pipe.ZAdd(ctx, activeIndexKey, redis.Z{Score: float64(time.Now().UnixNano()), Member: routeID.String()})
+}
+
+// GetRoutePathRange returns the points of a route with from <= timestamp <= to.
+// A zero from or to leaves that side of the range open.
+func (r *Repository) GetRoutePathRange(ctx context.Context, routeID uuid.UUID, from, to time.Time) ([]models.GPSData, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return nil, fmt.Errorf("route id is required")
+	}
+
+	items, err := r.client.ZRangeByScore(ctx, routePathKey(routeID), scoreRange(from, to)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodePath(items)
+}
+
+// PruneActiveIndex drops routes from the active index whose last write is
+// older than the route TTL, so their keys have expired. It returns how many
+// were removed.
+func (r *Repository) PruneActiveIndex(ctx context.Context, now time.Time) (int64, error) {
+	if r == nil || r.client == nil {
+		return 0, fmt.Errorf("redis repository is not initialized")
+	}
+	if r.ttl <= 0 {
+		return 0, nil
+	}
+	stale := strconv.FormatInt(now.Add(-r.ttl).UnixNano(), 10)
+	return r.client.ZRemRangeByScore(ctx, activeIndexKey, "-inf", "("+stale).Result()
+}
+
+// GetPointsSince returns every point with timestamp >= since across all
+// routes that were written to since then.
+func (r *Repository) GetPointsSince(ctx context.Context, since time.Time) ([]models.RoutePosition, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis repository is not initialized")
+	}
+
+	members, err := r.client.ZRangeByScore(ctx, activeIndexKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.UnixNano(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	routeIDs := make([]uuid.UUID, 0, len(members))
+	cmds := make([]*redis.StringSliceCmd, 0, len(members))
+	pipe := r.client.Pipeline()
+	for _, member := range members {
+		routeID, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		routeIDs = append(routeIDs, routeID)
+		cmds = append(cmds, pipe.ZRangeByScore(ctx, routePathKey(routeID), scoreRange(since, time.Time{})))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var result []models.RoutePosition
+	for i, cmd := range cmds {
+		path, err := decodePath(cmd.Val())
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range path {
+			result = append(result, models.RoutePosition{RouteID: routeIDs[i], GPSData: point})
+		}
+	}
+	return result, nil
+}
+
+func scoreRange(from, to time.Time) *redis.ZRangeBy {
+	rng := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !from.IsZero() {
+		rng.Min = strconv.FormatInt(from.UnixNano(), 10)
+	}
+	if !to.IsZero() {
+		rng.Max = strconv.FormatInt(to.UnixNano(), 10)
+	}
+	return rng
+}
+
+func decodePath(items []string) ([]models.GPSData, error) {
+	path := make([]models.GPSData, 0, len(items))
+	for _, raw := range items {
+		point, err := decodePoint([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, point)
+	}
+	return path, nil
+}
+
+// GetRoutePathPage returns up to limit points after the cursor. Points with
+// equal scores are ordered by member, so skipping after.Skip of them resumes
+// where the previous page stopped. An empty page for a route with neither a
+// meta nor a path key is reported as ErrRouteNotFound.
+func (r *Repository) GetRoutePathPage(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error) {
+	if r == nil || r.client == nil {
+		return models.PathPage{}, fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return models.PathPage{}, fmt.Errorf("route id is required")
+	}
+	if limit <= 0 {
+		return models.PathPage{}, fmt.Errorf("limit must be positive")
+	}
+
+	pathKey := routePathKey(routeID)
+	rng := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Offset: int64(after.Skip), Count: int64(limit) + 1}
+	if !after.Timestamp.IsZero() {
+		rng.Min = strconv.FormatInt(after.Timestamp.UnixNano(), 10)
+	}
+	items, err := r.client.ZRangeByScore(ctx, pathKey, rng).Result()
+	if err != nil {
+		return models.PathPage{}, err
+	}
+	if len(items) == 0 {
+		exists, err := r.client.Exists(ctx, routeMetaKey(routeID), pathKey).Result()
+		if err != nil {
+			return models.PathPage{}, err
+		}
+		if exists == 0 {
+			return models.PathPage{}, ErrRouteNotFound
+		}
+		return models.PathPage{Points: []models.GPSData{}}, nil
+	}
+
+	path, err := decodePath(items)
+	if err != nil {
+		return models.PathPage{}, err
+	}
+	return models.NewPathPage(path, limit, after), nil
+}
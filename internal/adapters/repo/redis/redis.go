@@ -19,20 +19,57 @@ const (
 	routePathSuffix = ":gps"
 	startTimeField  = "start_time"
 	endTimeField    = "end_time"
+	statsField      = "stats"
+	finishedField   = "finished"
+	ownerField      = "owner_id"
+	dueIndexKey     = "routes:due"
+	activeIndexKey  = "routes:active"
+	maxTxRetries    = 10
 )
 
 type Repository struct {
 	client *redis.Client
 	ttl    time.Duration
+	// dueAfter is how long after its last write a route becomes due for
+	// archiving; it leaves a fifth of the TTL as head room.
+	dueAfter time.Duration
 }
 
-var ErrRouteNotFound = errors.New("route not found")
+var ErrRouteNotFound = models.ErrRouteNotFound
+
+// claimDueScript re-scores a due route into the future so that only one
+// replica archives it at a time.
+var claimDueScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// finishRouteScript pins the end time of a route that still exists and
+// renews its TTL, so finishing never recreates an expired route as a hash
+// without expiry.
+var finishRouteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2], ARGV[3], 1)
+local ttl = tonumber(ARGV[4])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+redis.call('ZADD', KEYS[3], ARGV[5], ARGV[6])
+return 1
+`)
 
 func NewRepository(client *redis.Client, ttl time.Duration) (*Repository, error) {
 	if client == nil {
 		return nil, fmt.Errorf("redis client is nil")
 	}
-	return &Repository{client: client, ttl: ttl}, nil
+	return &Repository{client: client, ttl: ttl, dueAfter: ttl * 4 / 5}, nil
 }
 
 func (r *Repository) StoreRoute(ctx context.Context, route models.Route) error {
@@ -49,7 +86,7 @@ func (r *Repository) StoreRoute(ctx context.Context, route models.Route) error {
 	pipe := r.client.TxPipeline()
 	pipe.Del(ctx, routeKey, pathKey)
 
-	if !route.StartTime.IsZero() || !route.EndTime.IsZero() {
+	if !route.StartTime.IsZero() || !route.EndTime.IsZero() || route.Finished || route.OwnerID != uuid.Nil {
 		fields := map[string]any{}
 		if !route.StartTime.IsZero() {
 			fields[startTimeField] = route.StartTime.UnixNano()
@@ -57,15 +94,20 @@ func (r *Repository) StoreRoute(ctx context.Context, route models.Route) error {
 		if !route.EndTime.IsZero() {
 			fields[endTimeField] = route.EndTime.UnixNano()
 		}
+		if route.Finished {
+			fields[finishedField] = 1
+		}
+		if route.OwnerID != uuid.Nil {
+			fields[ownerField] = route.OwnerID.String()
+		}
 		pipe.HSet(ctx, routeKey, fields)
 	}
+	if route.OwnerID != uuid.Nil {
+		markOwned(ctx, pipe, route.OwnerID, route.RouteID)
+	}
 
 	for _, point := range route.Path {
-		payload, err := json.Marshal(point)
-		if err != nil {
-			pipe.Discard()
-			return err
-		}
+		payload := encodePoint(point)
 		score := float64(point.Timestamp.UnixNano())
 		pipe.ZAdd(ctx, pathKey, redis.Z{Score: score, Member: payload})
 	}
@@ -73,6 +115,8 @@ func (r *Repository) StoreRoute(ctx context.Context, route models.Route) error {
 		pipe.Expire(ctx, routeKey, r.ttl)
 		pipe.Expire(ctx, pathKey, r.ttl)
 	}
+	r.markDue(ctx, pipe, route.RouteID, route.Finished)
+	markActive(ctx, pipe, route.RouteID)
 
 	_, err := pipe.Exec(ctx)
 	return err
@@ -88,11 +132,7 @@ func (r *Repository) AppendRoutePoint(ctx context.Context, routeID uuid.UUID, po
 
 	routeKey := routeMetaKey(routeID)
 	pathKey := routePathKey(routeID)
-	payload, err := json.Marshal(point)
-	if err != nil {
-		return err
-	}
-
+	payload := encodePoint(point)
 	score := float64(point.Timestamp.UnixNano())
 	pipe := r.client.TxPipeline()
 	pipe.ZAdd(ctx, pathKey, redis.Z{Score: score, Member: payload})
@@ -103,11 +143,97 @@ func (r *Repository) AppendRoutePoint(ctx context.Context, routeID uuid.UUID, po
 		pipe.Expire(ctx, routeKey, r.ttl)
 		pipe.Expire(ctx, pathKey, r.ttl)
 	}
+	r.markDue(ctx, pipe, routeID, false)
+	markActive(ctx, pipe, routeID)
 
-	_, err = pipe.Exec(ctx)
+	_, err := pipe.Exec(ctx)
 	return err
 }
 
+// AppendRoutePointWithStats appends point and updates the streaming route
+// statistics kept in the route hash in one optimistic transaction, so any
+// replica can resume the aggregation. fold receives the stored stats and
+// reports whether the point was accepted; rejected points are still stored
+// in the path but leave the stats untouched.
+func (r *Repository) AppendRoutePointWithStats(ctx context.Context, routeID uuid.UUID, point models.GPSData, fold func(*models.RouteStats) bool) (models.RouteStats, error) {
+	if r == nil || r.client == nil {
+		return models.RouteStats{}, fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return models.RouteStats{}, fmt.Errorf("route id is required")
+	}
+
+	routeKey := routeMetaKey(routeID)
+	pathKey := routePathKey(routeID)
+	payload := encodePoint(point)
+	score := float64(point.Timestamp.UnixNano())
+
+	var stats models.RouteStats
+	txf := func(tx *redis.Tx) error {
+		current, err := readRouteStats(ctx, tx, routeID)
+		if err != nil && !errors.Is(err, ErrRouteNotFound) {
+			return err
+		}
+		stats = current
+		accepted := fold(&stats)
+		encoded, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, pathKey, redis.Z{Score: score, Member: payload})
+			pipe.HSetNX(ctx, routeKey, startTimeField, point.Timestamp.UnixNano())
+			if accepted {
+				pipe.HSet(ctx, routeKey, endTimeField, point.Timestamp.UnixNano(), statsField, encoded)
+			}
+			if r.ttl > 0 {
+				pipe.Expire(ctx, routeKey, r.ttl)
+				pipe.Expire(ctx, pathKey, r.ttl)
+			}
+			r.markDue(ctx, pipe, routeID, false)
+			markActive(ctx, pipe, routeID)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < maxTxRetries; i++ {
+		err = r.client.Watch(ctx, txf, routeKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return stats, err
+	}
+	return models.RouteStats{}, err
+}
+
+func (r *Repository) GetRouteStats(ctx context.Context, routeID uuid.UUID) (models.RouteStats, error) {
+	if r == nil || r.client == nil {
+		return models.RouteStats{}, fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return models.RouteStats{}, fmt.Errorf("route id is required")
+	}
+	return readRouteStats(ctx, r.client, routeID)
+}
+
+func readRouteStats(ctx context.Context, client redis.Cmdable, routeID uuid.UUID) (models.RouteStats, error) {
+	stats := models.RouteStats{RouteID: routeID}
+	raw, err := client.HGet(ctx, routeMetaKey(routeID), statsField).Result()
+	if errors.Is(err, redis.Nil) {
+		return stats, ErrRouteNotFound
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := json.Unmarshal([]byte(raw), &stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
 func (r *Repository) GetRoute(ctx context.Context, routeID uuid.UUID) (models.Route, error) {
 	if r == nil || r.client == nil {
 		return models.Route{}, fmt.Errorf("redis repository is not initialized")
@@ -125,25 +251,111 @@ func (r *Repository) GetRoute(ctx context.Context, routeID uuid.UUID) (models.Ro
 		return models.Route{}, ErrRouteNotFound
 	}
 
-	path := make([]models.GPSData, 0, len(items))
-	for _, raw := range items {
-		var point models.GPSData
-		if err := json.Unmarshal([]byte(raw), &point); err != nil {
-			return models.Route{}, err
-		}
-		path = append(path, point)
+	path, err := decodePath(items)
+	if err != nil {
+		return models.Route{}, err
 	}
 
 	start, end := r.resolveRouteBounds(ctx, routeID, path)
+	finished, err := r.client.HExists(ctx, routeMetaKey(routeID), finishedField).Result()
+	if err != nil {
+		return models.Route{}, err
+	}
+	owner, err := r.readOwner(ctx, routeID)
+	if err != nil {
+		return models.Route{}, err
+	}
 
 	return models.Route{
 		RouteID:   routeID,
+		OwnerID:   owner,
 		StartTime: start,
 		EndTime:   end,
+		Finished:  finished,
 		Path:      path,
 	}, nil
 }
 
+// FinishRoute marks a route as finished, pins its end time and schedules it
+// for archiving. It returns ErrRouteNotFound if the route already expired.
+func (r *Repository) FinishRoute(ctx context.Context, routeID uuid.UUID, endTime time.Time) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	if routeID == uuid.Nil {
+		return fmt.Errorf("route id is required")
+	}
+	keys := []string{routeMetaKey(routeID), routePathKey(routeID), dueIndexKey}
+	ok, err := finishRouteScript.Run(ctx, r.client, keys,
+		endTimeField, endTime.UnixNano(), finishedField,
+		r.ttl.Milliseconds(), time.Now().UnixNano(), routeID.String(),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrRouteNotFound
+	}
+	return nil
+}
+
+// markDue schedules the route for archiving: finished routes immediately,
+// active ones shortly before their keys expire.
+func (r *Repository) markDue(ctx context.Context, pipe redis.Pipeliner, routeID uuid.UUID, finished bool) {
+	due := time.Now()
+	if !finished {
+		if r.ttl <= 0 {
+			return
+		}
+		due = due.Add(r.dueAfter)
+	}
+	pipe.ZAdd(ctx, dueIndexKey, redis.Z{Score: float64(due.UnixNano()), Member: routeID.String()})
+}
+
+// ClaimDueRoutes returns up to limit routes that are due for archiving at
+// now and hides them from other callers for lease.
+func (r *Repository) ClaimDueRoutes(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]uuid.UUID, error) {
+	if r == nil || r.client == nil {
+		return nil, fmt.Errorf("redis repository is not initialized")
+	}
+	nowScore := strconv.FormatInt(now.UnixNano(), 10)
+	members, err := r.client.ZRangeByScore(ctx, dueIndexKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   nowScore,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	leaseScore := strconv.FormatInt(now.Add(lease).UnixNano(), 10)
+	claimed := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		ok, err := claimDueScript.Run(ctx, r.client, []string{dueIndexKey}, member, nowScore, leaseScore).Int()
+		if err != nil {
+			return claimed, err
+		}
+		if ok == 0 {
+			continue
+		}
+		routeID, err := uuid.Parse(member)
+		if err != nil {
+			r.client.ZRem(ctx, dueIndexKey, member)
+			continue
+		}
+		claimed = append(claimed, routeID)
+	}
+	return claimed, nil
+}
+
+// ReleaseDueRoute removes a route from the archiving index.
+func (r *Repository) ReleaseDueRoute(ctx context.Context, routeID uuid.UUID) error {
+	if r == nil || r.client == nil {
+		return fmt.Errorf("redis repository is not initialized")
+	}
+	return r.client.ZRem(ctx, dueIndexKey, routeID.String()).Err()
+}
+
 func (r *Repository) GetRoutePath(ctx context.Context, routeID uuid.UUID) ([]models.GPSData, error) {
 	if r == nil || r.client == nil {
 		return nil, fmt.Errorf("redis repository is not initialized")
@@ -157,16 +369,7 @@ func (r *Repository) GetRoutePath(ctx context.Context, routeID uuid.UUID) ([]mod
 	if err != nil {
 		return nil, err
 	}
-
-	path := make([]models.GPSData, 0, len(items))
-	for _, raw := range items {
-		var point models.GPSData
-		if err := json.Unmarshal([]byte(raw), &point); err != nil {
-			return nil, err
-		}
-		path = append(path, point)
-	}
-	return path, nil
+	return decodePath(items)
 }
 
 func (r *Repository) DeleteRoute(ctx context.Context, routeID uuid.UUID) error {
@@ -179,7 +382,11 @@ func (r *Repository) DeleteRoute(ctx context.Context, routeID uuid.UUID) error {
 
 	routeKey := routeMetaKey(routeID)
 	pathKey := routePathKey(routeID)
-	return r.client.Del(ctx, routeKey, pathKey).Err()
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, routeKey, pathKey)
+	pipe.ZRem(ctx, activeIndexKey, routeID.String())
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 func routeMetaKey(routeID uuid.UUID) string {
@@ -0,0 +1,128 @@
+package roadgraph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported road graph format")
+
+// Load reads a road extract from local disk. Only GeoJSON is parsed natively;
+// OSM PBF extracts have to be converted first, e.g. with
+// `osmium export -f geojson extract.osm.pbf`.
+func Load(path string) (*services.RoadGraph, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".geojson", ".json":
+		return LoadGeoJSON(path)
+	case ".pbf":
+		return nil, fmt.Errorf("%w: convert %s to GeoJSON first", ErrUnsupportedFormat, path)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+}
+
+type featureCollection struct {
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Geometry   geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func LoadGeoJSON(path string) (*services.RoadGraph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var collection featureCollection
+	if err := json.NewDecoder(file).Decode(&collection); err != nil {
+		return nil, err
+	}
+
+	graph := services.NewRoadGraph()
+	for _, f := range collection.Features {
+		lines, err := f.Geometry.lines()
+		if err != nil {
+			return nil, err
+		}
+		oneway, reversed := onewayFlags(f.Properties)
+		for _, line := range lines {
+			if reversed {
+				for i, j := 0, len(line)-1; i < j; i, j = i+1, j-1 {
+					line[i], line[j] = line[j], line[i]
+				}
+			}
+			graph.AddRoad(line, oneway)
+		}
+	}
+	if len(graph.Edges) == 0 {
+		return nil, fmt.Errorf("no road geometry found in %s", path)
+	}
+	return graph, nil
+}
+
+func (g geometry) lines() ([][]models.Location, error) {
+	switch g.Type {
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+			return nil, err
+		}
+		return [][]models.Location{toLocations(coords)}, nil
+	case "MultiLineString":
+		var coords [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+			return nil, err
+		}
+		lines := make([][]models.Location, 0, len(coords))
+		for _, c := range coords {
+			lines = append(lines, toLocations(c))
+		}
+		return lines, nil
+	default:
+		return nil, nil
+	}
+}
+
+func toLocations(coords [][]float64) []models.Location {
+	line := make([]models.Location, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			continue
+		}
+		line = append(line, models.Location{Longitude: c[0], Latitude: c[1]})
+	}
+	return line
+}
+
+// onewayFlags follows the OSM oneway tag: "yes"/"true"/"1" means forward
+// only, "-1" means the road is drivable against the drawing direction only.
+func onewayFlags(props map[string]any) (bool, bool) {
+	switch v := props["oneway"].(type) {
+	case bool:
+		return v, false
+	case string:
+		switch strings.ToLower(v) {
+		case "yes", "true", "1":
+			return true, false
+		case "-1", "reverse":
+			return true, true
+		}
+	}
+	return false, false
+}
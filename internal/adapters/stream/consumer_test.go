@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+	"gps/pkg/exchanger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type fakePending struct {
+	msg        redis.XMessage
+	deliveries int64
+	idle       bool
+}
+
+// fakeStream is one consumer group over an in-memory stream. Reads hand out
+// entries once; onRead runs before every XREADGROUP so a test can stop Run.
+type fakeStream struct {
+	mu      sync.Mutex
+	entries []redis.XMessage
+	next    int
+	pending map[string]*fakePending
+	acked   []string
+	dead    []map[string]any
+	readErr error
+	addErr  error
+	onRead  func()
+}
+
+func newFakeStream(entries ...redis.XMessage) *fakeStream {
+	return &fakeStream{entries: entries, pending: make(map[string]*fakePending)}
+}
+
+func (f *fakeStream) XGroupCreateMkStream(context.Context, string, string, string) *redis.StatusCmd {
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (f *fakeStream) XReadGroup(_ context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	if f.onRead != nil {
+		f.onRead()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.readErr != nil {
+		return redis.NewXStreamSliceCmdResult(nil, f.readErr)
+	}
+	if f.next >= len(f.entries) {
+		return redis.NewXStreamSliceCmdResult(nil, redis.Nil)
+	}
+	end := min(f.next+int(a.Count), len(f.entries))
+	messages := f.entries[f.next:end]
+	f.next = end
+	for _, msg := range messages {
+		f.pending[msg.ID] = &fakePending{msg: msg, deliveries: 1}
+	}
+	return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+}
+
+func (f *fakeStream) XPendingExt(ctx context.Context, _ *redis.XPendingExtArgs) *redis.XPendingExtCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := redis.NewXPendingExtCmd(ctx)
+	var val []redis.XPendingExt
+	for _, msg := range f.entries {
+		if p, ok := f.pending[msg.ID]; ok && p.idle {
+			val = append(val, redis.XPendingExt{ID: msg.ID, RetryCount: p.deliveries})
+		}
+	}
+	cmd.SetVal(val)
+	return cmd
+}
+
+func (f *fakeStream) XClaim(_ context.Context, a *redis.XClaimArgs) *redis.XMessageSliceCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []redis.XMessage
+	for _, id := range a.Messages {
+		if p, ok := f.pending[id]; ok {
+			p.deliveries++
+			p.idle = false
+			claimed = append(claimed, p.msg)
+		}
+	}
+	return redis.NewXMessageSliceCmdResult(claimed, nil)
+}
+
+func (f *fakeStream) XAck(_ context.Context, _, _ string, ids ...string) *redis.IntCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.pending, id)
+		f.acked = append(f.acked, id)
+	}
+	return redis.NewIntResult(int64(len(ids)), nil)
+}
+
+func (f *fakeStream) XAdd(_ context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.addErr != nil {
+		return redis.NewStringResult("", f.addErr)
+	}
+	f.dead = append(f.dead, a.Values.(map[string]any))
+	return redis.NewStringResult("1-0", nil)
+}
+
+func pointEntry(id string) redis.XMessage {
+	return redis.XMessage{ID: id, Values: map[string]any{
+		fieldExchanger: "dev-1",
+		fieldData:      `{"location":{"latitude":43.25,"longitude":76.95},"timestamp":"2025-01-02T03:04:05Z"}`,
+	}}
+}
+
+func newTestConsumer(t *testing.T, client *fakeStream) *Consumer[models.GPSData] {
+	t.Helper()
+	c, err := newConsumer[models.GPSData](client, "gps:points", "ingest", "c1", ConsumerParams{MaxDeliveries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// runUntilDrained runs the consumer until every entry has been read once.
+func runUntilDrained(t *testing.T, client *fakeStream, handle func(context.Context, exchanger.Task[models.GPSData]) error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.onRead = func() {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if client.next >= len(client.entries) && len(client.entries) > 0 {
+			cancel()
+		}
+	}
+	if err := newTestConsumer(t, client).Run(ctx, handle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumerAcksHandledEntries(t *testing.T) {
+	client := newFakeStream(pointEntry("1-0"), pointEntry("2-0"))
+	var handled []string
+	runUntilDrained(t, client, func(_ context.Context, task exchanger.Task[models.GPSData]) error {
+		handled = append(handled, task.Exchanger)
+		return nil
+	})
+
+	if len(handled) != 2 || len(client.acked) != 2 || len(client.pending) != 0 || len(client.dead) != 0 {
+		t.Fatalf("handled %v, acked %v, pending %d, dead %d", handled, client.acked, len(client.pending), len(client.dead))
+	}
+}
+
+func TestConsumerDeadLettersFailedEntry(t *testing.T) {
+	client := newFakeStream(pointEntry("1-0"))
+	runUntilDrained(t, client, func(context.Context, exchanger.Task[models.GPSData]) error {
+		return errors.New("append failed")
+	})
+
+	if len(client.dead) != 1 || len(client.acked) != 1 || len(client.pending) != 0 {
+		t.Fatalf("dead %v, acked %v, pending %d", client.dead, client.acked, len(client.pending))
+	}
+	dead := client.dead[0]
+	if dead[fieldSourceID] != "1-0" || dead[fieldError] != "append failed" || dead[fieldData] == nil {
+		t.Fatalf("unexpected dead-letter entry %v", dead)
+	}
+}
+
+func TestConsumerKeepsEntryWhenDeadLetterFails(t *testing.T) {
+	client := newFakeStream(pointEntry("1-0"))
+	client.addErr = errors.New("redis down")
+	runUntilDrained(t, client, func(context.Context, exchanger.Task[models.GPSData]) error {
+		return errors.New("append failed")
+	})
+
+	if len(client.acked) != 0 || client.pending["1-0"] == nil {
+		t.Fatalf("expected entry to stay pending, acked %v", client.acked)
+	}
+}
+
+func TestConsumerAcksMalformedEntry(t *testing.T) {
+	client := newFakeStream(redis.XMessage{ID: "1-0", Values: map[string]any{fieldExchanger: "dev-1"}})
+	runUntilDrained(t, client, func(context.Context, exchanger.Task[models.GPSData]) error {
+		t.Fatal("handler called for malformed entry")
+		return nil
+	})
+
+	if len(client.acked) != 1 || len(client.dead) != 0 {
+		t.Fatalf("acked %v, dead %v", client.acked, client.dead)
+	}
+}
+
+func TestReclaimRetriesIdleEntriesAndDeadLettersExhausted(t *testing.T) {
+	client := newFakeStream(pointEntry("1-0"), pointEntry("2-0"), pointEntry("3-0"))
+	client.next = 3
+	client.pending["1-0"] = &fakePending{msg: client.entries[0], deliveries: 1, idle: true}
+	client.pending["2-0"] = &fakePending{msg: client.entries[1], deliveries: 3, idle: true}
+	client.pending["3-0"] = &fakePending{msg: client.entries[2], deliveries: 1}
+
+	claimed, err := newTestConsumer(t, client).reclaim(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != "1-0" {
+		t.Fatalf("expected only 1-0 to be retried, got %v", claimed)
+	}
+	if len(client.dead) != 1 || client.dead[0][fieldSourceID] != "2-0" {
+		t.Fatalf("expected 2-0 to be dead-lettered, got %v", client.dead)
+	}
+	if client.pending["2-0"] != nil || client.pending["1-0"] == nil || client.pending["3-0"] == nil {
+		t.Fatalf("unexpected pending entries %v", client.pending)
+	}
+}
+
+func TestConsumerStopsDuringReadRetry(t *testing.T) {
+	client := newFakeStream()
+	client.readErr = errors.New("connection refused")
+	ctx, cancel := context.WithCancel(context.Background())
+	// Cancel while Run waits to retry the failed read, not during it.
+	var once sync.Once
+	client.onRead = func() { once.Do(func() { time.AfterFunc(10*time.Millisecond, cancel) }) }
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newTestConsumer(t, client).Run(ctx, func(context.Context, exchanger.Task[models.GPSData]) error { return nil })
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(readRetryDelay / 2):
+		t.Fatal("Run kept waiting after ctx was cancelled")
+	}
+}
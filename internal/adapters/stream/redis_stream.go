@@ -0,0 +1,368 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gps/pkg/exchanger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	fieldExchanger = "exchanger"
+	fieldData      = "data"
+	fieldError     = "error"
+	fieldSourceID  = "source_id"
+
+	deadLetterSuffix = ":dead"
+	readRetryDelay   = time.Second
+
+	minPublishBackoff = 100 * time.Millisecond
+	maxPublishBackoff = 5 * time.Second
+)
+
+// Publisher appends exchanger tasks to a Redis stream so they survive a
+// crash of the ingesting process and can be consumed by other processes.
+type Publisher[T any] struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewPublisher trims the stream to roughly maxLen entries on every append;
+// a non-positive maxLen keeps every entry.
+func NewPublisher[T any](client *redis.Client, stream string, maxLen int64) (*Publisher[T], error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis client is required")
+	}
+	if stream == "" {
+		return nil, fmt.Errorf("stream name is required")
+	}
+	return &Publisher[T]{client: client, stream: stream, maxLen: maxLen}, nil
+}
+
+func (p *Publisher[T]) Publish(ctx context.Context, task exchanger.Task[T]) error {
+	args, err := p.xaddArgs(task)
+	if err != nil {
+		return err
+	}
+	return p.client.XAdd(ctx, args).Err()
+}
+
+func (p *Publisher[T]) xaddArgs(task exchanger.Task[T]) (*redis.XAddArgs, error) {
+	data, err := json.Marshal(task.Data)
+	if err != nil {
+		return nil, err
+	}
+	args := &redis.XAddArgs{
+		Stream: p.stream,
+		Values: map[string]any{fieldExchanger: task.Exchanger, fieldData: data},
+	}
+	if p.maxLen > 0 {
+		args.MaxLen = p.maxLen
+		args.Approx = true
+	}
+	return args, nil
+}
+
+// Run publishes every task from in, typically Pool.Out(), until in is closed
+// or ctx is cancelled. A failed append is retried with exponential backoff
+// rather than dropped; while Redis is down the backlog stays in the pool.
+func (p *Publisher[T]) Run(ctx context.Context, in <-chan exchanger.Task[T]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-in:
+			if !ok {
+				return
+			}
+			if !p.publishWithRetry(ctx, task) {
+				return
+			}
+		}
+	}
+}
+
+// publishWithRetry reports false only when ctx ended before the task was
+// appended. Tasks that cannot be encoded are dropped, since retrying would
+// not help.
+func (p *Publisher[T]) publishWithRetry(ctx context.Context, task exchanger.Task[T]) bool {
+	args, err := p.xaddArgs(task)
+	if err != nil {
+		slog.Error("Stream publish dropped unencodable task", "stream", p.stream, "exchanger", task.Exchanger, "error", err)
+		return true
+	}
+	backoff := minPublishBackoff
+	for {
+		err := p.client.XAdd(ctx, args).Err()
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			slog.Error("Stream publish abandoned", "stream", p.stream, "exchanger", task.Exchanger, "error", err)
+			return false
+		}
+		slog.Warn("Stream publish failed, retrying", "stream", p.stream, "exchanger", task.Exchanger, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Error("Stream publish abandoned", "stream", p.stream, "exchanger", task.Exchanger, "error", err)
+			return false
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxPublishBackoff)
+	}
+}
+
+// ConsumerParams tunes how a consumer reads and recovers entries.
+type ConsumerParams struct {
+	// Batch is how many entries one XREADGROUP returns.
+	Batch int64
+	// Block is how long XREADGROUP waits for new entries.
+	Block time.Duration
+	// MinIdle is how long an entry stays pending before another consumer
+	// may claim it.
+	MinIdle time.Duration
+	// MaxDeliveries dead-letters an entry after it was delivered this many
+	// times without being acknowledged.
+	MaxDeliveries int64
+	// DeadLetter is the stream that receives entries the handler failed on;
+	// it defaults to the stream name with a ":dead" suffix.
+	DeadLetter string
+}
+
+func DefaultConsumerParams() ConsumerParams {
+	return ConsumerParams{
+		Batch:         100,
+		Block:         5 * time.Second,
+		MinIdle:       time.Minute,
+		MaxDeliveries: 5,
+	}
+}
+
+// streamClient is the part of *redis.Client the consumer uses.
+type streamClient interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XPendingExt(ctx context.Context, a *redis.XPendingExtArgs) *redis.XPendingExtCmd
+	XClaim(ctx context.Context, a *redis.XClaimArgs) *redis.XMessageSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+}
+
+// Consumer reads tasks from a stream as one member of a consumer group.
+// Handlers are not idempotent, so an entry the handler fails on is moved to
+// the dead-letter stream and acknowledged rather than retried. Entries left
+// pending by a crashed consumer are reclaimed once they have been idle for
+// MinIdle.
+type Consumer[T any] struct {
+	client   streamClient
+	stream   string
+	group    string
+	consumer string
+	params   ConsumerParams
+}
+
+func NewConsumer[T any](client *redis.Client, stream, group, consumer string, params ConsumerParams) (*Consumer[T], error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis client is required")
+	}
+	return newConsumer[T](client, stream, group, consumer, params)
+}
+
+func newConsumer[T any](client streamClient, stream, group, consumer string, params ConsumerParams) (*Consumer[T], error) {
+	if stream == "" || group == "" || consumer == "" {
+		return nil, fmt.Errorf("stream, group and consumer names are required")
+	}
+	defaults := DefaultConsumerParams()
+	if params.Batch <= 0 {
+		params.Batch = defaults.Batch
+	}
+	if params.Block <= 0 {
+		params.Block = defaults.Block
+	}
+	if params.MinIdle <= 0 {
+		params.MinIdle = defaults.MinIdle
+	}
+	if params.MaxDeliveries <= 0 {
+		params.MaxDeliveries = defaults.MaxDeliveries
+	}
+	if params.DeadLetter == "" {
+		params.DeadLetter = stream + deadLetterSuffix
+	}
+	return &Consumer[T]{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		params:   params,
+	}, nil
+}
+
+// Run creates the group if needed and hands every entry to handle until ctx
+// is cancelled. Pending entries are reclaimed before each read.
+func (c *Consumer[T]) Run(ctx context.Context, handle func(context.Context, exchanger.Task[T]) error) error {
+	if err := c.ensureGroup(ctx); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		claimed, err := c.reclaim(ctx)
+		if err != nil {
+			slog.Warn("Stream reclaim failed", "stream", c.stream, "error", err)
+		}
+		c.process(ctx, claimed, handle)
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.consumer,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.params.Batch,
+			Block:    c.params.Block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			slog.Error("Stream read failed", "stream", c.stream, "error", err)
+			timer := time.NewTimer(readRetryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+			continue
+		}
+		for _, s := range streams {
+			c.process(ctx, s.Messages, handle)
+		}
+	}
+	return nil
+}
+
+func (c *Consumer[T]) ensureGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// reclaim takes over entries that have been pending longer than MinIdle.
+// Entries already delivered MaxDeliveries times are dead-lettered so a
+// poison entry cannot block the group forever.
+func (c *Consumer[T]) reclaim(ctx context.Context) ([]redis.XMessage, error) {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Idle:   c.params.MinIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  c.params.Batch,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(pending))
+	exhausted := make(map[string]int64)
+	for i, p := range pending {
+		ids[i] = p.ID
+		if p.RetryCount >= c.params.MaxDeliveries {
+			exhausted[p.ID] = p.RetryCount
+		}
+	}
+	claimed, err := c.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  c.params.MinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	retry := claimed[:0]
+	for _, msg := range claimed {
+		deliveries, ok := exhausted[msg.ID]
+		if !ok {
+			retry = append(retry, msg)
+			continue
+		}
+		slog.Error("Dead-lettering stream entry after repeated deliveries", "stream", c.stream, "id", msg.ID, "deliveries", deliveries)
+		c.deadLetter(ctx, msg, fmt.Errorf("delivered %d times without ack", deliveries))
+	}
+	return retry, nil
+}
+
+func (c *Consumer[T]) process(ctx context.Context, messages []redis.XMessage, handle func(context.Context, exchanger.Task[T]) error) {
+	for _, msg := range messages {
+		task, err := decodeTask[T](msg)
+		if err != nil {
+			// Malformed entries never decode; acknowledge them right away.
+			slog.Error("Dropping malformed stream entry", "stream", c.stream, "id", msg.ID, "error", err)
+			c.ack(ctx, msg.ID)
+			continue
+		}
+		if err := handle(ctx, task); err != nil {
+			if ctx.Err() != nil {
+				// Shutting down; leave the entry for reclaim.
+				return
+			}
+			slog.Warn("Stream entry handler failed", "stream", c.stream, "id", msg.ID, "error", err)
+			c.deadLetter(ctx, msg, err)
+			continue
+		}
+		c.ack(ctx, msg.ID)
+	}
+}
+
+// deadLetter copies msg to the dead-letter stream with the failure and
+// acknowledges it. If the copy fails the entry stays pending, so it is
+// reclaimed later instead of lost.
+func (c *Consumer[T]) deadLetter(ctx context.Context, msg redis.XMessage, cause error) {
+	values := make(map[string]any, len(msg.Values)+2)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[fieldSourceID] = msg.ID
+	values[fieldError] = cause.Error()
+	if err := c.client.XAdd(ctx, &redis.XAddArgs{Stream: c.params.DeadLetter, Values: values}).Err(); err != nil {
+		slog.Error("Stream dead-letter failed", "stream", c.stream, "id", msg.ID, "error", err)
+		return
+	}
+	c.ack(ctx, msg.ID)
+}
+
+func (c *Consumer[T]) ack(ctx context.Context, id string) {
+	if err := c.client.XAck(ctx, c.stream, c.group, id).Err(); err != nil {
+		slog.Warn("Stream ack failed", "stream", c.stream, "id", id, "error", err)
+	}
+}
+
+func decodeTask[T any](msg redis.XMessage) (exchanger.Task[T], error) {
+	name, _ := msg.Values[fieldExchanger].(string)
+	raw, ok := msg.Values[fieldData].(string)
+	if !ok {
+		return exchanger.Task[T]{}, fmt.Errorf("entry %s has no %s field", msg.ID, fieldData)
+	}
+	var data T
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return exchanger.Task[T]{}, err
+	}
+	return exchanger.WrapTask(name, data), nil
+}
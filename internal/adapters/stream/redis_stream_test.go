@@ -0,0 +1,35 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDecodeTask(t *testing.T) {
+	point := models.GPSData{
+		Location:  models.Location{Latitude: 43.25, Longitude: 76.95},
+		Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := json.Marshal(point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := redis.XMessage{ID: "1-0", Values: map[string]any{fieldExchanger: "dev-1", fieldData: string(data)}}
+
+	task, err := decodeTask[models.GPSData](msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Exchanger != "dev-1" || task.Data.Location != point.Location || !task.Data.Timestamp.Equal(point.Timestamp) {
+		t.Fatalf("unexpected task %+v", task)
+	}
+
+	if _, err := decodeTask[models.GPSData](redis.XMessage{ID: "2-0", Values: map[string]any{fieldExchanger: "dev-1"}}); err == nil {
+		t.Fatal("expected error for entry without data")
+	}
+}
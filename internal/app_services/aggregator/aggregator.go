@@ -1,7 +1,49 @@
 package aggregator
 
+import (
+	"context"
 
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+
+	"github.com/google/uuid"
+)
+
+// AggregatorService keeps live route statistics in Redis and updates them in
+// O(1) per incoming point.
 type AggregatorService struct {
+	repo       interfaces.RedisRouteRepository
+	aggregator *services.Aggregator
+}
 
+func NewAggregatorService(repo interfaces.RedisRouteRepository, aggregator *services.Aggregator) *AggregatorService {
+	if aggregator == nil {
+		aggregator = services.NewAggregator()
+	}
+	return &AggregatorService{
+		repo:       repo,
+		aggregator: aggregator,
+	}
+}
+
+func (s *AggregatorService) AppendPoint(ctx context.Context, routeID uuid.UUID, point models.GPSData) (models.AggregatedData, error) {
+	stats, err := s.repo.AppendRoutePointWithStats(ctx, routeID, point, func(stats *models.RouteStats) bool {
+		acc := s.aggregator.ResumeAccumulator(*stats)
+		accepted := acc.Add(point)
+		*stats = acc.Stats()
+		return accepted
+	})
+	if err != nil {
+		return models.AggregatedData{}, err
+	}
+	return s.aggregator.ResumeAccumulator(stats).Aggregated(), nil
+}
 
+func (s *AggregatorService) Current(ctx context.Context, routeID uuid.UUID) (models.AggregatedData, error) {
+	stats, err := s.repo.GetRouteStats(ctx, routeID)
+	if err != nil {
+		return models.AggregatedData{}, err
+	}
+	return s.aggregator.ResumeAccumulator(stats).Aggregated(), nil
 }
@@ -0,0 +1,112 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/pkg/conc"
+
+	"github.com/google/uuid"
+)
+
+// Archiver copies routes from Redis to Mongo before they expire. Finished
+// routes are removed from Redis once persisted; idle ones are left to their
+// TTL and archived again if they expire with new points. A trip that ends
+// after its live copy expired is finished in Mongo by FinishExpired.
+type Archiver struct {
+	live     interfaces.RedisRouteRepository
+	archive  interfaces.RouteArchive
+	interval time.Duration
+	lease    time.Duration
+	batch    int
+}
+
+func NewArchiver(live interfaces.RedisRouteRepository, archive interfaces.RouteArchive, interval, lease time.Duration, batch int) *Archiver {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	if lease <= 0 {
+		lease = time.Minute
+	}
+	if batch <= 0 {
+		batch = 100
+	}
+	return &Archiver{
+		live:     live,
+		archive:  archive,
+		interval: interval,
+		lease:    lease,
+		batch:    batch,
+	}
+}
+
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := conc.NewTicker()
+	ticker.Start(ctx, a.interval, func() {
+		now := time.Now()
+		if err := a.ArchiveDue(ctx, now); err != nil {
+			slog.Error("Route archiving failed", "error", err)
+		}
+		if _, err := a.live.PruneActiveIndex(ctx, now); err != nil {
+			slog.Error("Failed to prune active route index", "error", err)
+		}
+	})
+}
+
+// ArchiveDue drains the due index in batches until nothing is left at now.
+func (a *Archiver) ArchiveDue(ctx context.Context, now time.Time) error {
+	for {
+		routeIDs, err := a.live.ClaimDueRoutes(ctx, now, a.lease, a.batch)
+		if err != nil {
+			return err
+		}
+		for _, routeID := range routeIDs {
+			if err := a.archiveRoute(ctx, routeID); err != nil {
+				slog.Error("Failed to archive route", "route_id", routeID, "error", err)
+			}
+		}
+		if len(routeIDs) < a.batch {
+			return nil
+		}
+	}
+}
+
+func (a *Archiver) archiveRoute(ctx context.Context, routeID uuid.UUID) error {
+	route, err := a.live.GetRoute(ctx, routeID)
+	if errors.Is(err, models.ErrRouteNotFound) {
+		// Whatever was archived before expiry stays unfinished until the
+		// trip ends and FinishExpired pins its end time.
+		slog.Warn("Route expired before it could be archived", "route_id", routeID)
+		return a.live.ReleaseDueRoute(ctx, routeID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := a.archive.UpsertRoute(ctx, route); err != nil {
+		return err
+	}
+	if !route.Finished {
+		return nil
+	}
+	if err := a.live.DeleteRoute(ctx, routeID); err != nil {
+		return err
+	}
+	return a.live.ReleaseDueRoute(ctx, routeID)
+}
+
+// FinishExpired marks the archived copy of a route finished at endTime and
+// returns it. It is used when the live route expired before its trip ended.
+func (a *Archiver) FinishExpired(ctx context.Context, routeID uuid.UUID, endTime time.Time) (models.Route, error) {
+	if err := a.archive.FinishArchivedRoute(ctx, routeID, endTime); err != nil {
+		return models.Route{}, err
+	}
+	if err := a.live.ReleaseDueRoute(ctx, routeID); err != nil {
+		return models.Route{}, err
+	}
+	return a.archive.GetRouteByID(ctx, routeID)
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+const refreshTokenBytes = 32
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Tokens is what sign up, log in and refresh return. RefreshToken is empty
+// when refresh tokens are not configured.
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// WithRefreshTokens enables refresh tokens valid for ttl. Every refresh
+// rotates the token; presenting a rotated token again revokes its family.
+func WithRefreshTokens(store refreshStore, ttl time.Duration) AuthOption {
+	return func(s *AuthService) {
+		s.refresh = store
+		s.refreshTTL = ttl
+		if s.refreshTTL <= 0 {
+			s.refreshTTL = 30 * 24 * time.Hour
+		}
+	}
+}
+
+// WithDenylist makes ValidateToken reject access tokens revoked by Logout.
+func WithDenylist(list denylist) AuthOption {
+	return func(s *AuthService) {
+		s.denylist = list
+	}
+}
+
+// Refresh exchanges a refresh token for a new token pair. The user is
+// reloaded so role changes apply from the next refresh.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	if s.refresh == nil || refreshToken == "" {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	stored, err := s.refresh.UseRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, models.ErrTokenReused) {
+		slog.Warn("Refresh token reuse detected, revoking family", "user_id", stored.UserID, "family_id", stored.FamilyID)
+		if err := s.refresh.RevokeTokenFamily(ctx, stored.FamilyID); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.issue(ctx, user, stored.FamilyID)
+}
+
+// Logout revokes the access token and, when given, the family of the
+// refresh token. The refresh token is only looked up, not consumed, so one
+// that belongs to another user is left untouched.
+func (s *AuthService) Logout(ctx context.Context, claims JWTClaims, refreshToken string) error {
+	if s.denylist != nil && claims.ExpiresAt != nil {
+		if err := s.denylist.DenyToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+	if s.refresh == nil || refreshToken == "" {
+		return nil
+	}
+	stored, err := s.refresh.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stored.UserID != claims.UserID {
+		return nil
+	}
+	return s.refresh.RevokeTokenFamily(ctx, stored.FamilyID)
+}
+
+// issue creates an access token and, if enabled, a refresh token in the
+// given family; uuid.Nil starts a new family.
+func (s *AuthService) issue(ctx context.Context, user models.User, familyID uuid.UUID) (Tokens, error) {
+	access, err := s.tokenFor(user)
+	if err != nil {
+		return Tokens{}, err
+	}
+	tokens := Tokens{AccessToken: access, ExpiresIn: int64(s.signer.TTL() / time.Second)}
+	if s.refresh == nil {
+		return tokens, nil
+	}
+
+	raw := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return Tokens{}, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(raw)
+	if familyID == uuid.Nil {
+		familyID = uuid.New()
+	}
+	now := time.Now().UTC()
+	err = s.refresh.StoreRefreshToken(ctx, models.RefreshToken{
+		TokenHash: hashRefreshToken(refresh),
+		FamilyID:  familyID,
+		UserID:    user.UserID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	tokens.RefreshToken = refresh
+	return tokens, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
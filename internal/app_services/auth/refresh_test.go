@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type memoryUsers struct {
+	user models.User
+}
+
+func (m *memoryUsers) CreateUser(ctx context.Context, username, passwordHash string, roles []models.Role) (uuid.UUID, error) {
+	m.user = models.User{UserID: uuid.New(), Username: username, PasswordHash: passwordHash, Roles: roles}
+	return m.user.UserID, nil
+}
+
+func (m *memoryUsers) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	if m.user.Username != username {
+		return models.User{}, models.ErrUserNotFound
+	}
+	return m.user, nil
+}
+
+func (m *memoryUsers) GetUserByID(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	if m.user.UserID != userID {
+		return models.User{}, models.ErrUserNotFound
+	}
+	return m.user, nil
+}
+
+func (m *memoryUsers) UpdateUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) error {
+	m.user.Roles, m.user.Permissions = roles, permissions
+	return nil
+}
+
+type memoryTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken
+	denied map[string]bool
+}
+
+func newMemoryTokens() *memoryTokens {
+	return &memoryTokens{tokens: make(map[string]*models.RefreshToken), denied: make(map[string]bool)}
+}
+
+func (m *memoryTokens) StoreRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.TokenHash] = &token
+	return nil
+}
+
+func (m *memoryTokens) UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return models.RefreshToken{}, models.ErrTokenNotFound
+	}
+	if token.Used || token.Revoked {
+		return *token, models.ErrTokenReused
+	}
+	token.Used = true
+	return *token, nil
+}
+
+func (m *memoryTokens) GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[tokenHash]
+	if !ok {
+		return models.RefreshToken{}, models.ErrTokenNotFound
+	}
+	return *token, nil
+}
+
+func (m *memoryTokens) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryTokens) DenyToken(ctx context.Context, jti string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.denied[jti] = true
+	return nil
+}
+
+func (m *memoryTokens) IsTokenDenied(ctx context.Context, jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.denied[jti], nil
+}
+
+func testSigner(t *testing.T) *Signer {
+	t.Helper()
+	signer, err := NewHMACSigner([]byte("test-secret"), "test", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestRefreshRotationAndReuseDetection(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTokens()
+	svc := NewAuthService(&memoryUsers{}, testSigner(t), WithRefreshTokens(store, time.Hour), WithDenylist(store))
+
+	first, err := svc.SignUp(ctx, Input{Username: "driver1", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RefreshToken == "" {
+		t.Fatal("expected a refresh token")
+	}
+
+	second, err := svc.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Replaying the rotated token revokes the family, including the
+	// token issued by the legitimate refresh.
+	if _, err := svc.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected reuse to be rejected, got %v", err)
+	}
+	if _, err := svc.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected family to be revoked, got %v", err)
+	}
+}
+
+func TestLogoutDeniesAccessToken(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTokens()
+	svc := NewAuthService(&memoryUsers{}, testSigner(t), WithRefreshTokens(store, time.Hour), WithDenylist(store))
+
+	tokens, err := svc.SignUp(ctx, Input{Username: "viewer1", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.ValidateToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Logout(ctx, claims, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ValidateToken(ctx, tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected revoked token, got %v", err)
+	}
+	if _, err := svc.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected refresh after logout to fail, got %v", err)
+	}
+}
+
+func TestLogoutIgnoresAnotherUsersRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTokens()
+	svc := NewAuthService(&memoryUsers{}, testSigner(t), WithRefreshTokens(store, time.Hour), WithDenylist(store))
+
+	tokens, err := svc.SignUp(ctx, Input{Username: "viewer1", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.ValidateToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.UserID = uuid.New()
+	if err := svc.Logout(ctx, claims, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("expected the owner's refresh token to stay usable, got %v", err)
+	}
+}
+
+func TestPromoteAdminOnlyAffectsExistingUsers(t *testing.T) {
+	ctx := context.Background()
+	users := &memoryUsers{}
+	svc := NewAuthService(users, testSigner(t))
+
+	if err := svc.PromoteAdmin(ctx, "root"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := svc.SignUp(ctx, Input{Username: "root", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(users.user.Roles, models.RoleAdmin) {
+		t.Fatalf("sign up must not grant admin")
+	}
+	if err := svc.PromoteAdmin(ctx, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(users.user.Roles, models.RoleAdmin) || !slices.Contains(users.user.Roles, models.RoleViewer) {
+		t.Fatalf("expected admin added to existing roles, got %v", users.user.Roles)
+	}
+}
@@ -2,7 +2,10 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"gps/internal/config"
 	"gps/internal/domain/models"
@@ -11,14 +14,44 @@ import (
 )
 
 var (
-	ErrUserNotFound       = fmt.Errorf("user not found")
+	ErrUserNotFound       = models.ErrUserNotFound
+	ErrUsernameTaken      = models.ErrDuplicateUsername
 	ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+	ErrNoSigningKey       = fmt.Errorf("JWT_PRIVATE_KEY_PATH or JWT_SECRET must be set")
 	ErrFailedToCreateUser = fmt.Errorf("failed to create user")
 	ErrUnauthorized       = fmt.Errorf("unauthorized")
+	ErrInvalidRole        = fmt.Errorf("invalid role or permission")
+	ErrTokenRevoked       = fmt.Errorf("token revoked")
 )
 
-func ConfigureJWT(cfg config.JWTConfig) {
-	SetJWTConfig(cfg.Secret, cfg.Expiry)
+// NewSignerFromConfig loads the asymmetric signing key when one is
+// configured and falls back to the HS256 secret otherwise. There is no
+// default secret; one of the two must be set.
+func NewSignerFromConfig(cfg config.JWTConfig) (*Signer, error) {
+	var (
+		signer *Signer
+		err    error
+	)
+	opts := []SignerOption{
+		WithIssuer(cfg.Issuer),
+		WithAudience(cfg.Audience),
+		WithLeeway(cfg.ClockSkew),
+	}
+	switch {
+	case cfg.PrivateKeyPath != "":
+		signer, err = LoadKeySigner(cfg.PrivateKeyPath, cfg.KeyID, cfg.Expiry, opts...)
+	case cfg.Secret != "":
+		signer, err = NewHMACSigner([]byte(cfg.Secret), cfg.KeyID, cfg.Expiry, opts...)
+	default:
+		return nil, ErrNoSigningKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.LoadVerificationKeys(cfg.VerifyKeys); err != nil {
+		return nil, err
+	}
+	return signer, nil
 }
 
 type Input struct {
@@ -27,65 +60,172 @@ type Input struct {
 }
 
 type repo interface {
-	CreateUser(ctx context.Context, username, passwordHash string) (uuid.UUID, error)
+	CreateUser(ctx context.Context, username, passwordHash string, roles []models.Role) (uuid.UUID, error)
 	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (models.User, error)
+	UpdateUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) error
+}
+
+// refreshStore and denylist mirror interfaces.RefreshTokenRepository and
+// interfaces.TokenDenylist; that package imports this one.
+type refreshStore interface {
+	StoreRefreshToken(ctx context.Context, token models.RefreshToken) error
+	UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error
+}
+
+type denylist interface {
+	DenyToken(ctx context.Context, jti string, until time.Time) error
+	IsTokenDenied(ctx context.Context, jti string) (bool, error)
 }
 
 type AuthService struct {
-	repo repo
+	repo        repo
+	signer      *Signer
+	defaultRole models.Role
+	refresh     refreshStore
+	refreshTTL  time.Duration
+	denylist    denylist
 }
 
-func NewAuthService(repo repo) *AuthService {
-	return &AuthService{
-		repo: repo,
+type AuthOption func(*AuthService)
+
+// WithDefaultRole sets the role given to new users and to users stored
+// before roles existed. It defaults to viewer.
+func WithDefaultRole(role models.Role) AuthOption {
+	return func(s *AuthService) {
+		if role.Valid() {
+			s.defaultRole = role
+		}
 	}
 }
 
-func (s *AuthService) SignUp(ctx context.Context, input Input) (string, error) {
+func NewAuthService(repo repo, signer *Signer, opts ...AuthOption) *AuthService {
+	s := &AuthService{
+		repo:        repo,
+		signer:      signer,
+		defaultRole: models.RoleViewer,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *AuthService) SignUp(ctx context.Context, input Input) (Tokens, error) {
 	hashedPassword, err := hashPassword(input.Password)
 	if err != nil {
-		return "", err
+		return Tokens{}, err
 	}
 
-	id, err := s.repo.CreateUser(ctx, input.Username, hashedPassword)
+	roles := []models.Role{s.defaultRole}
+	id, err := s.repo.CreateUser(ctx, input.Username, hashedPassword, roles)
 	if err != nil {
-		return "", err
+		return Tokens{}, err
 	}
-	token, err := generateToken(JWTClaims{
-		UserID:   id,
-		Username: input.Username,
-	})
-
-	return token, nil
+	return s.issue(ctx, models.User{UserID: id, Username: input.Username, Roles: roles}, uuid.Nil)
 }
 
-func (s *AuthService) LogIn(ctx context.Context, input Input) (string, error) {
+func (s *AuthService) LogIn(ctx context.Context, input Input) (Tokens, error) {
 
 	inputUsername := input.Username
 	user, err := s.repo.GetUserByUsername(ctx, inputUsername)
 
+	if errors.Is(err, models.ErrUserNotFound) {
+		return Tokens{}, ErrUserNotFound
+	}
 	if err != nil {
-		return "", ErrUserNotFound
+		return Tokens{}, err
 	}
 
 	isValid := verifyPassword(input.Password, user.PasswordHash)
 
 	if !isValid {
-		return "", ErrInvalidCredentials
+		return Tokens{}, ErrInvalidCredentials
 	}
 
-	token, err := generateToken(JWTClaims{
-		UserID:   user.UserID,
-		Username: user.Username,
-	})
+	return s.issue(ctx, user, uuid.Nil)
+}
 
+// SetRoles replaces the roles and direct permissions of a user. The change
+// takes effect with the user's next token.
+func (s *AuthService) SetRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) (models.User, error) {
+	for _, role := range roles {
+		if !role.Valid() {
+			return models.User{}, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+	for _, perm := range permissions {
+		if !perm.Valid() {
+			return models.User{}, fmt.Errorf("%w: %q", ErrInvalidRole, perm)
+		}
+	}
+	if err := s.repo.UpdateUserRoles(ctx, userID, roles, permissions); err != nil {
+		return models.User{}, err
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
-		return "", err
+		return models.User{}, err
 	}
+	user.PasswordHash = ""
+	return user, nil
+}
 
-	return token, nil
+// PromoteAdmin grants the admin role to an existing user, so a fresh
+// deployment has someone who can assign roles. Sign up never grants admin.
+func (s *AuthService) PromoteAdmin(ctx context.Context, username string) error {
+	user, err := s.repo.GetUserByUsername(ctx, username)
+	if errors.Is(err, models.ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if slices.Contains(user.Roles, models.RoleAdmin) {
+		return nil
+	}
+	return s.repo.UpdateUserRoles(ctx, user.UserID, append(user.Roles, models.RoleAdmin), user.Permissions)
+}
+
+// tokenFor embeds the user's roles and effective permissions in a new
+// token. Users stored before roles existed get the default role.
+func (s *AuthService) tokenFor(user models.User) (string, error) {
+	if len(user.Roles) == 0 && len(user.Permissions) == 0 {
+		user.Roles = []models.Role{s.defaultRole}
+	}
+	return s.signer.Sign(JWTClaims{
+		UserID:      user.UserID,
+		Username:    user.Username,
+		Roles:       user.Roles,
+		Permissions: user.EffectivePermissions(),
+	})
+}
+
+// JWKS returns the public keys other services use to verify tokens.
+func (s *AuthService) JWKS() JWKS {
+	return s.signer.JWKS()
 }
 
 func (s *AuthService) ParseToken(tokenStr string) (JWTClaims, error) {
-	return parseToken(tokenStr)
+	return s.signer.Parse(tokenStr)
+}
+
+// ValidateToken parses an access token and rejects it if it was revoked by
+// logging out.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenStr string) (JWTClaims, error) {
+	claims, err := s.signer.Parse(tokenStr)
+	if err != nil {
+		return JWTClaims{}, err
+	}
+	if s.denylist != nil {
+		denied, err := s.denylist.IsTokenDenied(ctx, claims.ID)
+		if err != nil {
+			return JWTClaims{}, err
+		}
+		if denied {
+			return JWTClaims{}, ErrTokenRevoked
+		}
+	}
+	return claims, nil
 }
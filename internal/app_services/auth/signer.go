@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// verificationKey is a key tokens may be signed with, identified by kid.
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    any
+}
+
+// Signer issues and verifies access tokens. It signs with one active key
+// and verifies with every key in its set, so a previous key can stay in the
+// set while tokens signed with it expire.
+type Signer struct {
+	method  jwt.SigningMethod
+	signKey any
+	kid     string
+	ttl     time.Duration
+	keys    map[string]verificationKey
+
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+type SignerOption func(*Signer)
+
+// WithIssuer stamps iss on issued tokens and requires it on parsed ones.
+func WithIssuer(issuer string) SignerOption {
+	return func(s *Signer) {
+		s.issuer = issuer
+	}
+}
+
+// WithAudience stamps aud on issued tokens and requires parsed tokens to
+// name it.
+func WithAudience(audience string) SignerOption {
+	return func(s *Signer) {
+		s.audience = audience
+	}
+}
+
+// WithLeeway tolerates clock skew between issuer and verifier when checking
+// exp, iat and nbf.
+func WithLeeway(leeway time.Duration) SignerOption {
+	return func(s *Signer) {
+		if leeway > 0 {
+			s.leeway = leeway
+		}
+	}
+}
+
+// NewHMACSigner signs with a shared HS256 secret. HMAC keys are never
+// published in the JWKS, so only services holding the secret can verify.
+// An empty kid is derived from the secret, so replicas sharing it agree.
+func NewHMACSigner(secret []byte, kid string, ttl time.Duration, opts ...SignerOption) (*Signer, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("hmac secret is required")
+	}
+	if kid == "" {
+		kid = hmacKeyID(secret)
+	}
+	s := newSigner(jwt.SigningMethodHS256, secret, kid, ttl, opts)
+	s.keys[s.kid] = verificationKey{method: jwt.SigningMethodHS256, key: secret}
+	return s, nil
+}
+
+// NewKeySigner signs with an RSA (RS256), P-256 ECDSA (ES256) or Ed25519
+// (EdDSA) private key; the algorithm follows from the key type. An empty
+// kid defaults to the RFC 7638 thumbprint of the public key.
+func NewKeySigner(private crypto.Signer, kid string, ttl time.Duration, opts ...SignerOption) (*Signer, error) {
+	method, err := methodFor(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		jwk, _ := toJWK("", verificationKey{method: method, key: private.Public()})
+		kid = Thumbprint(jwk)
+	}
+	s := newSigner(method, private, kid, ttl, opts)
+	s.keys[s.kid] = verificationKey{method: method, key: private.Public()}
+	return s, nil
+}
+
+// LoadKeySigner reads a PKCS#8, PKCS#1 or SEC 1 private key from a PEM file.
+func LoadKeySigner(path, kid string, ttl time.Duration, opts ...SignerOption) (*Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	private, err := parsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewKeySigner(private, kid, ttl, opts...)
+}
+
+func newSigner(method jwt.SigningMethod, key any, kid string, ttl time.Duration, opts []SignerOption) *Signer {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	s := &Signer{
+		method:  method,
+		signKey: key,
+		kid:     kid,
+		ttl:     ttl,
+		keys:    make(map[string]verificationKey),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// AddVerificationKey accepts tokens signed by the matching private key
+// under kid, typically the previous key during a rotation.
+func (s *Signer) AddVerificationKey(kid string, public crypto.PublicKey) error {
+	if kid == "" {
+		return fmt.Errorf("kid is required")
+	}
+	method, err := methodFor(public)
+	if err != nil {
+		return err
+	}
+	s.keys[kid] = verificationKey{method: method, key: public}
+	return nil
+}
+
+// LoadVerificationKeys reads "kid=path" pairs separated by commas. Each
+// file holds a PEM public key or certificate.
+func (s *Signer) LoadVerificationKeys(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("verification key %q is not kid=path", entry)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		public, err := parsePublicKey(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := s.AddVerificationKey(kid, public); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign fills in the registered claims and signs with the active key.
+func (s *Signer) Sign(claims JWTClaims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    s.issuer,
+	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.signKey)
+}
+
+// Parse verifies a token against the key named by its kid header. The
+// algorithm must match that key, which rules out alg confusion. Every
+// failure wraps ErrInvalidToken.
+func (s *Signer) Parse(tokenString string) (JWTClaims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(s.leeway),
+	}
+	if s.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(s.audience))
+	}
+	claims := &JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key.key, nil
+	}, parserOpts...)
+	if err != nil {
+		return JWTClaims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return JWTClaims{}, ErrInvalidToken
+	}
+	return *claims, nil
+}
+
+// JWK is one public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public verification keys. HMAC secrets are left out.
+func (s *Signer) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for kid, key := range s.keys {
+		jwk, ok := toJWK(kid, key)
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func toJWK(kid string, key verificationKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: kid, Alg: key.method.Alg(), Use: "sig"}
+	switch k := key.key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(k.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = b64(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = b64(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(k)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of a public JWK: the
+// required members in lexicographic order, without whitespace.
+func Thumbprint(jwk JWK) string {
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	default:
+		return ""
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// hmacKeyID derives a kid from an HMAC secret. It is keyed by the secret
+// rather than a plain hash of it, so the kid in every token header does not
+// give offline guessing a cheap check.
+func hmacKeyID(secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("gps jwt kid"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func methodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %s, want P-256", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+func parsePrivateKey(raw []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key encoding")
+}
+
+func parsePublicKey(raw []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
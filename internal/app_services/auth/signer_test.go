@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writePrivateKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "key.pem", "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "pub.pem", "PUBLIC KEY", der)
+}
+
+func TestKeySignerRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key crypto.Signer
+		alg string
+		kty string
+	}{
+		{rsaKey, "RS256", "RSA"},
+		{ecKey, "ES256", "EC"},
+		{edKey, "EdDSA", "OKP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			signer, err := LoadKeySigner(writePrivateKey(t, tt.key), "k1", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID := uuid.New()
+			token, err := signer.Sign(JWTClaims{UserID: userID, Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := signer.Parse(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != userID || claims.ID == "" {
+				t.Fatalf("claims = %+v", claims)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &JWTClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != "k1" || parsed.Method.Alg() != tt.alg {
+				t.Fatalf("header = %v", parsed.Header)
+			}
+
+			set := signer.JWKS()
+			if len(set.Keys) != 1 {
+				t.Fatalf("jwks has %d keys, want 1", len(set.Keys))
+			}
+			if k := set.Keys[0]; k.Kid != "k1" || k.Alg != tt.alg || k.Kty != tt.kty {
+				t.Fatalf("jwk = %+v", k)
+			}
+		})
+	}
+}
+
+func TestSignerRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSigner, err := NewKeySigner(oldKey, "old", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := oldSigner.Sign(JWTClaims{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSigner, err := NewKeySigner(newKey, "new", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSigner.Parse(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Parse before rotation err = %v, want ErrUnknownKey", err)
+	}
+	if err := newSigner.LoadVerificationKeys("old=" + writePublicKey(t, oldKey.Public())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSigner.Parse(oldToken); err != nil {
+		t.Fatalf("Parse after rotation: %v", err)
+	}
+	if n := len(newSigner.JWKS().Keys); n != 2 {
+		t.Fatalf("jwks has %d keys, want 2", n)
+	}
+}
+
+func TestSignerRejectsAlgorithmMismatch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewKeySigner(key, "k1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An HS256 token keyed with the public modulus must not verify.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{Username: "mallory"})
+	forged.Header["kid"] = "k1"
+	token, err := forged.SignedString(key.PublicKey.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Parse(token); err == nil {
+		t.Fatal("Parse accepted a token with the wrong algorithm")
+	}
+}
+
+func TestHMACSignerIsNotPublished(t *testing.T) {
+	signer := testSigner(t)
+	if n := len(signer.JWKS().Keys); n != 0 {
+		t.Fatalf("jwks has %d keys, want 0", n)
+	}
+}
+
+func TestSignerIssuerAudienceAndLeeway(t *testing.T) {
+	secret := []byte("secret")
+	issuer, err := NewHMACSigner(secret, "k1", time.Minute, WithIssuer("gps"), WithAudience("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issuer.Sign(JWTClaims{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Parse(token); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	otherAudience, _ := NewHMACSigner(secret, "k1", time.Minute, WithIssuer("gps"), WithAudience("billing"))
+	if _, err := otherAudience.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong audience err = %v, want ErrInvalidToken", err)
+	}
+	otherIssuer, _ := NewHMACSigner(secret, "k1", time.Minute, WithIssuer("elsewhere"))
+	if _, err := otherIssuer.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong issuer err = %v, want ErrInvalidToken", err)
+	}
+
+	// A token expired a few seconds ago passes only within the leeway.
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-5 * time.Second)),
+	}})
+	expired.Header["kid"] = "k1"
+	expiredToken, err := expired.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, _ := NewHMACSigner(secret, "k1", time.Minute)
+	if _, err := strict.Parse(expiredToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expired token err = %v, want ErrInvalidToken", err)
+	}
+	lenient, _ := NewHMACSigner(secret, "k1", time.Minute, WithLeeway(30*time.Second))
+	if _, err := lenient.Parse(expiredToken); err != nil {
+		t.Fatalf("Parse within leeway: %v", err)
+	}
+}
+
+func TestDefaultKeyIDsAreDeterministic(t *testing.T) {
+	// RFC 8037 appendix A.3.
+	rfc := JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	if got, want := Thumbprint(rfc), "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Fatalf("thumbprint %q, want %q", got, want)
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewKeySigner(private, "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeySigner(private, "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.kid == "" || a.kid != b.kid || a.kid != a.JWKS().Keys[0].Kid {
+		t.Fatalf("key signer kids %q and %q differ", a.kid, b.kid)
+	}
+
+	h1, _ := NewHMACSigner([]byte("secret-one"), "", time.Minute)
+	h2, _ := NewHMACSigner([]byte("secret-one"), "", time.Minute)
+	h3, _ := NewHMACSigner([]byte("secret-two"), "", time.Minute)
+	if h1.kid != h2.kid || h1.kid == h3.kid {
+		t.Fatalf("hmac kids %q, %q, %q", h1.kid, h2.kid, h3.kid)
+	}
+}
@@ -0,0 +1,177 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidDevice = errors.New("invalid device")
+	// ErrUnknownDevice covers both unregistered IMEIs and wrong keys so
+	// callers cannot probe which IMEIs exist.
+	ErrUnknownDevice = errors.New("unknown device or invalid key")
+)
+
+const (
+	apiKeyBytes   = 32
+	maxIMEILength = 64
+)
+
+// Input is the admin-editable part of a device.
+type Input struct {
+	IMEI      string    `json:"imei"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	VehicleID string    `json:"vehicle_id"`
+	Protocol  string    `json:"protocol"`
+}
+
+// Service is the tracker registry. Trackers authenticate with their IMEI
+// and a per-device API key issued at registration.
+type Service struct {
+	repo interfaces.DeviceRepository
+}
+
+func NewService(repo interfaces.DeviceRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// Register stores a new device and returns its API key. The key is not
+// stored and cannot be shown again; RotateKey issues a new one.
+func (s *Service) Register(ctx context.Context, input Input) (string, models.Device, error) {
+	imei := strings.TrimSpace(input.IMEI)
+	if err := validateIMEI(imei); err != nil {
+		return "", models.Device{}, err
+	}
+	key, hash, err := newAPIKey()
+	if err != nil {
+		return "", models.Device{}, err
+	}
+	now := time.Now().UTC()
+	device := models.Device{
+		DeviceID:  uuid.New(),
+		IMEI:      imei,
+		OwnerID:   input.OwnerID,
+		VehicleID: input.VehicleID,
+		Protocol:  input.Protocol,
+		KeyHash:   hash,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateDevice(ctx, device); err != nil {
+		return "", models.Device{}, err
+	}
+	return key, device, nil
+}
+
+func (s *Service) Get(ctx context.Context, deviceID uuid.UUID) (models.Device, error) {
+	return s.repo.GetDevice(ctx, deviceID)
+}
+
+func (s *Service) List(ctx context.Context) ([]models.Device, error) {
+	return s.repo.ListDevices(ctx)
+}
+
+// Update changes the owner, vehicle and protocol. The IMEI identifies the
+// tracker and cannot be changed; register a new device instead.
+func (s *Service) Update(ctx context.Context, deviceID uuid.UUID, input Input) (models.Device, error) {
+	device, err := s.repo.GetDevice(ctx, deviceID)
+	if err != nil {
+		return models.Device{}, err
+	}
+	if input.IMEI != "" && strings.TrimSpace(input.IMEI) != device.IMEI {
+		return models.Device{}, fmt.Errorf("%w: imei cannot be changed", ErrInvalidDevice)
+	}
+	device.OwnerID = input.OwnerID
+	device.VehicleID = input.VehicleID
+	device.Protocol = input.Protocol
+	if err := s.repo.UpdateDevice(ctx, device); err != nil {
+		return models.Device{}, err
+	}
+	return s.repo.GetDevice(ctx, deviceID)
+}
+
+// RotateKey replaces the device API key; the old key stops working at once.
+func (s *Service) RotateKey(ctx context.Context, deviceID uuid.UUID) (string, error) {
+	key, hash, err := newAPIKey()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SetDeviceKey(ctx, deviceID, hash); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *Service) Delete(ctx context.Context, deviceID uuid.UUID) error {
+	return s.repo.DeleteDevice(ctx, deviceID)
+}
+
+// Authenticate returns the device registered under imei if key matches.
+func (s *Service) Authenticate(ctx context.Context, imei, key string) (models.Device, error) {
+	device, err := s.repo.GetDeviceByIMEI(ctx, imei)
+	if errors.Is(err, models.ErrDeviceNotFound) {
+		return models.Device{}, ErrUnknownDevice
+	}
+	if err != nil {
+		return models.Device{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashKey(key)), []byte(device.KeyHash)) != 1 {
+		return models.Device{}, ErrUnknownDevice
+	}
+	return device, nil
+}
+
+// Owner returns the user the device reporting as imei belongs to, or
+// uuid.Nil if the device has no owner.
+func (s *Service) Owner(ctx context.Context, imei string) (uuid.UUID, error) {
+	device, err := s.repo.GetDeviceByIMEI(ctx, imei)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return device.OwnerID, nil
+}
+
+// Verify is Authenticate for callers that only need a yes or no, such as
+// the exchanger pool.
+func (s *Service) Verify(ctx context.Context, imei, key string) error {
+	_, err := s.Authenticate(ctx, imei, key)
+	return err
+}
+
+func validateIMEI(imei string) error {
+	if imei == "" {
+		return fmt.Errorf("%w: imei is required", ErrInvalidDevice)
+	}
+	if len(imei) > maxIMEILength || strings.IndexFunc(imei, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("%w: imei must be at most %d characters without spaces", ErrInvalidDevice, maxIMEILength)
+	}
+	return nil
+}
+
+func newAPIKey() (string, string, error) {
+	raw := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(raw)
+	return key, hashKey(key), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
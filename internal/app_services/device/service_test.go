@@ -0,0 +1,114 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type memoryDevices struct {
+	byID map[uuid.UUID]models.Device
+}
+
+func (m *memoryDevices) CreateDevice(_ context.Context, device models.Device) error {
+	for _, d := range m.byID {
+		if d.IMEI == device.IMEI {
+			return models.ErrDuplicateDevice
+		}
+	}
+	m.byID[device.DeviceID] = device
+	return nil
+}
+
+func (m *memoryDevices) GetDevice(_ context.Context, id uuid.UUID) (models.Device, error) {
+	d, ok := m.byID[id]
+	if !ok {
+		return models.Device{}, models.ErrDeviceNotFound
+	}
+	return d, nil
+}
+
+func (m *memoryDevices) GetDeviceByIMEI(_ context.Context, imei string) (models.Device, error) {
+	for _, d := range m.byID {
+		if d.IMEI == imei {
+			return d, nil
+		}
+	}
+	return models.Device{}, models.ErrDeviceNotFound
+}
+
+func (m *memoryDevices) ListDevices(context.Context) ([]models.Device, error) {
+	devices := []models.Device{}
+	for _, d := range m.byID {
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func (m *memoryDevices) UpdateDevice(_ context.Context, device models.Device) error {
+	m.byID[device.DeviceID] = device
+	return nil
+}
+
+func (m *memoryDevices) SetDeviceKey(_ context.Context, id uuid.UUID, keyHash string) error {
+	d, ok := m.byID[id]
+	if !ok {
+		return models.ErrDeviceNotFound
+	}
+	d.KeyHash = keyHash
+	m.byID[id] = d
+	return nil
+}
+
+func (m *memoryDevices) DeleteDevice(_ context.Context, id uuid.UUID) error {
+	delete(m.byID, id)
+	return nil
+}
+
+func TestRegisterAuthenticateAndRotate(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(&memoryDevices{byID: map[uuid.UUID]models.Device{}})
+
+	key, device, err := svc.Register(ctx, Input{IMEI: " 359339075123456 ", Protocol: "gt06"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.IMEI != "359339075123456" || device.KeyHash == key {
+		t.Fatalf("device = %+v", device)
+	}
+	if _, _, err := svc.Register(ctx, Input{IMEI: "359339075123456"}); !errors.Is(err, models.ErrDuplicateDevice) {
+		t.Fatalf("duplicate err = %v", err)
+	}
+	if _, _, err := svc.Register(ctx, Input{IMEI: "has space"}); !errors.Is(err, ErrInvalidDevice) {
+		t.Fatalf("bad imei err = %v", err)
+	}
+
+	if _, err := svc.Authenticate(ctx, device.IMEI, key); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, device.IMEI, "wrong"); !errors.Is(err, ErrUnknownDevice) {
+		t.Fatalf("wrong key err = %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, "000", key); !errors.Is(err, ErrUnknownDevice) {
+		t.Fatalf("unknown imei err = %v", err)
+	}
+
+	rotated, err := svc.RotateKey(ctx, device.DeviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Verify(ctx, device.IMEI, key); !errors.Is(err, ErrUnknownDevice) {
+		t.Fatalf("old key err = %v", err)
+	}
+	if err := svc.Verify(ctx, device.IMEI, rotated); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+
+	if _, err := svc.Update(ctx, device.DeviceID, Input{IMEI: "other"}); !errors.Is(err, ErrInvalidDevice) {
+		t.Fatalf("imei change err = %v", err)
+	}
+}
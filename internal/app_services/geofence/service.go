@@ -0,0 +1,132 @@
+package geofence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidGeofence = errors.New("invalid geofence")
+
+type Service struct {
+	repo    interfaces.GeofenceRepository
+	engine  *services.GeofenceEngine
+	notify  chan<- ws.WriteToWs
+	dropped atomic.Uint64
+}
+
+// NewService wires the geofence engine to its storage. notify may be nil, in
+// which case events are only persisted. Notifications never block ingestion:
+// when notify is full they are dropped and counted, and clients can still
+// read the stored events.
+func NewService(repo interfaces.GeofenceRepository, engine *services.GeofenceEngine, notify chan<- ws.WriteToWs) *Service {
+	return &Service{
+		repo:   repo,
+		engine: engine,
+		notify: notify,
+	}
+}
+
+func (s *Service) Load(ctx context.Context) error {
+	fences, err := s.repo.ListGeofences(ctx)
+	if err != nil {
+		return err
+	}
+	for _, fence := range fences {
+		s.engine.AddFence(fence)
+	}
+	return nil
+}
+
+func (s *Service) CreateFence(ctx context.Context, fence models.Geofence) (models.Geofence, error) {
+	if err := validateFence(fence); err != nil {
+		return models.Geofence{}, err
+	}
+	if fence.FenceID == uuid.Nil {
+		fence.FenceID = uuid.New()
+	}
+	fence.CreatedAt = time.Now()
+
+	if err := s.repo.CreateGeofence(ctx, fence); err != nil {
+		return models.Geofence{}, err
+	}
+	s.engine.AddFence(fence)
+	return fence, nil
+}
+
+func (s *Service) ListFences(ctx context.Context) ([]models.Geofence, error) {
+	return s.repo.ListGeofences(ctx)
+}
+
+func (s *Service) DeleteFence(ctx context.Context, fenceID uuid.UUID) error {
+	if err := s.repo.DeleteGeofence(ctx, fenceID); err != nil {
+		return err
+	}
+	s.engine.RemoveFence(fenceID)
+	return nil
+}
+
+func (s *Service) Events(ctx context.Context, fenceID uuid.UUID, limit int) ([]models.GeofenceEvent, error) {
+	return s.repo.GetGeofenceEvents(ctx, fenceID, limit)
+}
+
+func (s *Service) HandlePoint(ctx context.Context, deviceID string, point models.GPSData) error {
+	events := s.engine.Process(deviceID, point)
+	if len(events) == 0 {
+		return nil
+	}
+	if err := s.repo.StoreGeofenceEvents(ctx, events); err != nil {
+		return err
+	}
+	if s.notify == nil {
+		return nil
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		select {
+		case s.notify <- ws.WriteToWs{Payload: payload, ConsumerID: event.FenceID}:
+		default:
+			dropped := s.dropped.Add(1)
+			slog.Warn("Dropped geofence notification, websocket queue full", "fence_id", event.FenceID, "dropped", dropped)
+		}
+	}
+	return nil
+}
+
+// Dropped returns how many event notifications were dropped because the
+// websocket queue was full.
+func (s *Service) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func validateFence(fence models.Geofence) error {
+	switch fence.Type {
+	case models.GeofenceCircle:
+		if fence.Radius <= 0 {
+			return errors.Join(ErrInvalidGeofence, errors.New("radius must be positive"))
+		}
+	case models.GeofencePolygon:
+		if len(fence.Polygon) < 3 {
+			return errors.Join(ErrInvalidGeofence, errors.New("polygon needs at least 3 vertices"))
+		}
+	default:
+		return errors.Join(ErrInvalidGeofence, errors.New("unknown fence type"))
+	}
+	if fence.DwellTime < 0 {
+		return errors.Join(ErrInvalidGeofence, errors.New("dwell time must not be negative"))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package geofence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+)
+
+type memoryEvents struct {
+	interfaces.GeofenceRepository
+	stored []models.GeofenceEvent
+}
+
+func (m *memoryEvents) StoreGeofenceEvents(_ context.Context, events []models.GeofenceEvent) error {
+	m.stored = append(m.stored, events...)
+	return nil
+}
+
+func TestHandlePointDoesNotBlockOnFullNotify(t *testing.T) {
+	engine := services.NewGeofenceEngine(0.01)
+	engine.AddFence(models.Geofence{
+		FenceID: uuid.New(),
+		Type:    models.GeofenceCircle,
+		Center:  models.Location{Latitude: 51.5, Longitude: -0.12},
+		Radius:  200,
+	})
+	repo := &memoryEvents{}
+	// Nobody reads notify, like a stalled websocket manager.
+	svc := NewService(repo, engine, make(chan ws.WriteToWs))
+
+	start := time.Now()
+	points := []models.GPSData{
+		{Location: models.Location{Latitude: 51.51, Longitude: -0.12}, Timestamp: start},
+		{Location: models.Location{Latitude: 51.5005, Longitude: -0.12}, Timestamp: start.Add(time.Second)},
+	}
+	done := make(chan error, 1)
+	go func() {
+		for _, p := range points {
+			if err := svc.HandlePoint(context.Background(), "truck-1", p); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("HandlePoint blocked on the notify channel")
+	}
+	if len(repo.stored) != 1 || svc.Dropped() != 1 {
+		t.Fatalf("expected 1 stored and 1 dropped event, got %d and %d", len(repo.stored), svc.Dropped())
+	}
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"context"
+	"log/slog"
+
+	"gps/internal/domain/models"
+	"gps/pkg/exchanger"
+)
+
+type PointHandler interface {
+	HandlePoint(ctx context.Context, deviceID string, point models.GPSData) error
+}
+
+// PointFilter rewrites a point before it reaches the handlers, e.g. to
+// smooth out GPS jitter.
+type PointFilter interface {
+	FilterPoint(deviceID string, point models.GPSData) models.GPSData
+}
+
+// Service drains the exchanger pool, runs every point through the filters
+// and hands the result to the registered handlers in order. The exchanger
+// name is used as the device id.
+type Service struct {
+	filters  []PointFilter
+	handlers []PointHandler
+}
+
+func NewService(handlers ...PointHandler) *Service {
+	return &Service{handlers: handlers}
+}
+
+func (s *Service) WithFilters(filters ...PointFilter) {
+	s.filters = append(s.filters, filters...)
+}
+
+func (s *Service) Run(ctx context.Context, in <-chan exchanger.Task[models.GPSData]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-in:
+			if !ok {
+				return
+			}
+			if err := s.handle(ctx, task.Exchanger, task.Data); err != nil {
+				slog.Warn("Point handler failed", "device_id", task.Exchanger, "error", err)
+			}
+		}
+	}
+}
+
+// HandleTask processes one task outside Run, e.g. from a stream consumer.
+// It returns the first handler error. The handlers keep per-device state and
+// are not idempotent, so the caller must not redeliver a failed task; the
+// stream consumer dead-letters it instead.
+func (s *Service) HandleTask(ctx context.Context, task exchanger.Task[models.GPSData]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.handle(ctx, task.Exchanger, task.Data); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// handle runs every handler even after one fails, so a broken handler does
+// not starve the others, and returns the first error.
+func (s *Service) handle(ctx context.Context, deviceID string, point models.GPSData) error {
+	for _, f := range s.filters {
+		point = f.FilterPoint(deviceID, point)
+	}
+	var first error
+	for _, h := range s.handlers {
+		if err := h.HandlePoint(ctx, deviceID, point); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
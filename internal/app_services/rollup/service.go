@@ -0,0 +1,116 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+	"gps/pkg/conc"
+)
+
+const (
+	maxQueryBuckets = 10000
+	// finalFlushAttempts bounds how often the shutdown flush retries a
+	// failed write before the open buckets are given up.
+	finalFlushAttempts = 3
+)
+
+// Service builds minute rollups from ingested points and periodically
+// writes completed buckets to the time-series collection.
+type Service struct {
+	repo          interfaces.RollupRepository
+	builder       *services.RollupBuilder
+	flushInterval time.Duration
+	attribute     func(deviceID string) models.RollupKey
+}
+
+func NewService(repo interfaces.RollupRepository, builder *services.RollupBuilder, flushInterval time.Duration) *Service {
+	if flushInterval <= 0 {
+		flushInterval = 30 * time.Second
+	}
+	return &Service{
+		repo:          repo,
+		builder:       builder,
+		flushInterval: flushInterval,
+	}
+}
+
+// WithAttribution resolves the route and user a device is currently
+// reporting for. Without it rollups are keyed by device only.
+func (s *Service) WithAttribution(attribute func(deviceID string) models.RollupKey) {
+	s.attribute = attribute
+}
+
+func (s *Service) HandlePoint(ctx context.Context, deviceID string, point models.GPSData) error {
+	key := models.RollupKey{DeviceID: deviceID}
+	if s.attribute != nil {
+		key = s.attribute(deviceID)
+		key.DeviceID = deviceID
+	}
+	s.builder.Add(key, point)
+	return nil
+}
+
+// Run flushes completed buckets until ctx is cancelled and then writes out
+// whatever is still open.
+func (s *Service) Run(ctx context.Context) {
+	ticker := conc.NewTicker()
+	ticker.Start(ctx, s.flushInterval, func() {
+		s.flush(ctx, time.Now())
+	})
+	for attempt := 1; !s.flush(context.Background(), time.Now().Add(24*time.Hour)); attempt++ {
+		if attempt == finalFlushAttempts {
+			slog.Error("Giving up on unstored rollups at shutdown", "attempts", attempt)
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// flush stores the buckets completed by until. Rollups that were not stored
+// go back into the builder for the next flush; it reports whether all were
+// stored.
+func (s *Service) flush(ctx context.Context, until time.Time) bool {
+	rollups := s.builder.Flush(until)
+	if len(rollups) == 0 {
+		return true
+	}
+	stored, err := s.repo.StoreRollups(ctx, rollups)
+	if err != nil {
+		slog.Error("Failed to store rollups, requeueing", "stored", stored, "requeued", len(rollups)-stored, "error", err)
+		s.builder.Requeue(rollups[stored:])
+		return false
+	}
+	return true
+}
+
+func (s *Service) Query(ctx context.Context, q models.RollupQuery) ([]models.RollupResult, error) {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-24 * time.Hour)
+	}
+	if q.BucketSize <= 0 {
+		q.BucketSize = time.Hour
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = models.GroupByDevice
+	}
+	if !q.From.Before(q.To) {
+		return nil, errors.Join(models.ErrInvalidRollupQuery, errors.New("from must be before to"))
+	}
+	if q.To.Sub(q.From)/q.BucketSize > maxQueryBuckets {
+		return nil, errors.Join(models.ErrInvalidRollupQuery, errors.New("too many buckets for the requested range"))
+	}
+	switch q.GroupBy {
+	case models.GroupByDevice, models.GroupByRoute, models.GroupByUser:
+	default:
+		return nil, errors.Join(models.ErrInvalidRollupQuery, errors.New("group_by must be device, route or user"))
+	}
+	return s.repo.QueryRollups(ctx, q)
+}
@@ -0,0 +1,153 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageLimit = 500
+	MaxPageLimit     = 5000
+	exportPageSize   = 1000
+)
+
+var (
+	ErrInvalidRoute      = errors.New("invalid route")
+	ErrSmoothingDisabled = errors.New("route smoothing is not enabled")
+)
+
+// Smoother smooths a whole stored route offline.
+type Smoother interface {
+	SmoothRoute(route models.Route) models.Route
+}
+
+type liveStore interface {
+	interfaces.RoutePathPager
+	StoreRoute(ctx context.Context, route models.Route) error
+}
+
+// Service reads route paths page by page from Redis while a route is live
+// and from Mongo once it has been archived. New routes are written to Redis.
+type Service struct {
+	live     liveStore
+	archive  interfaces.RoutePathPager
+	smoother Smoother
+}
+
+func NewService(live liveStore, archive interfaces.RoutePathPager) *Service {
+	return &Service{
+		live:    live,
+		archive: archive,
+	}
+}
+
+// WithSmoother enables Smoothed.
+func (s *Service) WithSmoother(smoother Smoother) {
+	s.smoother = smoother
+}
+
+// Create stores a new live route owned by ownerID. The route id is always
+// assigned here so a caller cannot overwrite an existing route.
+func (s *Service) Create(ctx context.Context, ownerID uuid.UUID, route models.Route) (models.Route, error) {
+	if ownerID == uuid.Nil {
+		return models.Route{}, fmt.Errorf("%w: owner is required", ErrInvalidRoute)
+	}
+	if s.live == nil {
+		return models.Route{}, errors.New("live route store not configured")
+	}
+	sort.Slice(route.Path, func(i, j int) bool {
+		return route.Path[i].Timestamp.Before(route.Path[j].Timestamp)
+	})
+	route.RouteID = uuid.New()
+	route.OwnerID = ownerID
+	if route.StartTime.IsZero() && len(route.Path) > 0 {
+		route.StartTime = route.Path[0].Timestamp
+	}
+	if route.EndTime.IsZero() && len(route.Path) > 0 {
+		route.EndTime = route.Path[len(route.Path)-1].Timestamp
+	}
+	if route.StartTime.IsZero() {
+		route.StartTime = time.Now().UTC()
+	}
+	if err := s.live.StoreRoute(ctx, route); err != nil {
+		return models.Route{}, err
+	}
+	return route, nil
+}
+
+// Page returns up to limit points after the cursor. A non-positive limit
+// selects DefaultPageLimit and larger limits are capped at MaxPageLimit.
+func (s *Service) Page(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error) {
+	page, _, err := s.page(ctx, routeID, after, clampLimit(limit))
+	return page, err
+}
+
+// Export calls fn for every point of the route in timestamp order. Only one
+// page is held in memory at a time.
+func (s *Service) Export(ctx context.Context, routeID uuid.UUID, fn func(models.GPSData) error) error {
+	page, source, err := s.page(ctx, routeID, models.PathCursor{}, exportPageSize)
+	for {
+		if err != nil {
+			return err
+		}
+		for _, point := range page.Points {
+			if err := fn(point); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor.IsZero() {
+			return nil
+		}
+		page, err = source.GetRoutePathPage(ctx, routeID, page.NextCursor, exportPageSize)
+	}
+}
+
+// Smoothed returns the whole path of a route after offline smoothing.
+// Unlike Export it holds the full path in memory, since the backward pass
+// needs every point.
+func (s *Service) Smoothed(ctx context.Context, routeID uuid.UUID) ([]models.GPSData, error) {
+	if s.smoother == nil {
+		return nil, ErrSmoothingDisabled
+	}
+	var path []models.GPSData
+	err := s.Export(ctx, routeID, func(point models.GPSData) error {
+		path = append(path, point)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.smoother.SmoothRoute(models.Route{RouteID: routeID, Path: path}).Path, nil
+}
+
+// page tries the live store first and falls back to the archive when the
+// route is not in Redis. It also returns the store that answered so an
+// export keeps reading from one source.
+func (s *Service) page(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, interfaces.RoutePathPager, error) {
+	if s.live != nil {
+		page, err := s.live.GetRoutePathPage(ctx, routeID, after, limit)
+		if err == nil || !errors.Is(err, models.ErrRouteNotFound) {
+			return page, s.live, err
+		}
+	}
+	if s.archive == nil {
+		return models.PathPage{}, nil, models.ErrRouteNotFound
+	}
+	page, err := s.archive.GetRoutePathPage(ctx, routeID, after, limit)
+	return page, s.archive, err
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(limit, MaxPageLimit)
+}
@@ -0,0 +1,124 @@
+package route
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryPaths pages like the stores do: timestamp order, resuming at the
+// first point at the cursor's timestamp and skipping cursor.Skip of them.
+type memoryPaths struct {
+	paths map[uuid.UUID][]models.GPSData
+}
+
+func (m *memoryPaths) GetRoutePathPage(_ context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error) {
+	path, ok := m.paths[routeID]
+	if !ok {
+		return models.PathPage{}, models.ErrRouteNotFound
+	}
+	start := 0
+	for start < len(path) && path[start].Timestamp.Before(after.Timestamp) {
+		start++
+	}
+	start = min(start+after.Skip, len(path))
+	end := min(start+limit+1, len(path))
+	return models.NewPathPage(path[start:end], limit, after), nil
+}
+
+func (m *memoryPaths) StoreRoute(_ context.Context, route models.Route) error {
+	m.paths[route.RouteID] = route.Path
+	return nil
+}
+
+// tiedPath has runs of equal timestamps that straddle page boundaries.
+func tiedPath() []models.GPSData {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	offsets := []int{0, 0, 0, 1, 1, 2, 2, 2, 2, 3}
+	path := make([]models.GPSData, len(offsets))
+	for i, offset := range offsets {
+		path[i] = models.GPSData{
+			Location:  models.Location{Latitude: 52.5 + float64(i)*0.001, Longitude: 13.4},
+			Timestamp: start.Add(time.Duration(offset) * time.Second),
+		}
+	}
+	return path
+}
+
+func TestPageReturnsEveryPointWithTiedTimestamps(t *testing.T) {
+	routeID := uuid.New()
+	path := tiedPath()
+	svc := NewService(&memoryPaths{paths: map[uuid.UUID][]models.GPSData{routeID: path}}, nil)
+
+	for _, limit := range []int{1, 2, 3, 4} {
+		var got []models.GPSData
+		var cursor models.PathCursor
+		for range len(path) + 1 {
+			page, err := svc.Page(context.Background(), routeID, cursor, limit)
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+			got = append(got, page.Points...)
+			if page.NextCursor.IsZero() {
+				break
+			}
+			// Round-trip the cursor the way API clients see it.
+			cursor, err = models.ParsePathCursor(page.NextCursor.String())
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+		}
+		if len(got) != len(path) {
+			t.Fatalf("limit %d: expected %d points, got %d", limit, len(path), len(got))
+		}
+		for i := range path {
+			if got[i] != path[i] {
+				t.Fatalf("limit %d: point %d is %+v, want %+v", limit, i, got[i], path[i])
+			}
+		}
+	}
+}
+
+func TestExportFallsBackToArchive(t *testing.T) {
+	routeID := uuid.New()
+	path := tiedPath()
+	live := &memoryPaths{paths: map[uuid.UUID][]models.GPSData{}}
+	archive := &memoryPaths{paths: map[uuid.UUID][]models.GPSData{routeID: path}}
+	svc := NewService(live, archive)
+
+	var got []models.GPSData
+	err := svc.Export(context.Background(), routeID, func(point models.GPSData) error {
+		got = append(got, point)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(path) {
+		t.Fatalf("expected %d points, got %d", len(path), len(got))
+	}
+
+	if err := svc.Export(context.Background(), uuid.New(), func(models.GPSData) error { return nil }); err != models.ErrRouteNotFound {
+		t.Fatalf("expected ErrRouteNotFound, got %v", err)
+	}
+}
+
+func TestParsePathCursor(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 8, 0, 0, 500, time.UTC)
+	cursor := models.PathCursor{Timestamp: ts, Skip: 3}
+	parsed, err := models.ParsePathCursor(cursor.String())
+	if err != nil || !parsed.Timestamp.Equal(ts) || parsed.Skip != 3 {
+		t.Fatalf("round trip: got %+v, %v", parsed, err)
+	}
+	parsed, err = models.ParsePathCursor(ts.Format(time.RFC3339Nano))
+	if err != nil || parsed.Skip != 0 {
+		t.Fatalf("bare timestamp: got %+v, %v", parsed, err)
+	}
+	if _, err := models.ParsePathCursor("2026-03-01T08:00:00Z,-1"); err == nil {
+		t.Fatalf("expected negative skip to be rejected")
+	}
+}
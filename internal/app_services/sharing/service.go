@@ -0,0 +1,221 @@
+package sharing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrForbidden    = errors.New("forbidden")
+	ErrInvalidShare = errors.New("invalid share")
+)
+
+const (
+	defaultLinkTTL = 24 * time.Hour
+	linkTokenBytes = 32
+)
+
+type userLookup interface {
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+}
+
+// Service decides who may read and manage a route. The owner may do
+// anything; users the route is shared with may read it. Routes stored
+// before ownership existed have no owner and stay readable by any
+// authenticated user, but nobody can share them.
+type Service struct {
+	live       interfaces.RouteOwnerReader
+	archive    interfaces.RouteOwnerReader
+	shares     interfaces.ShareRepository
+	users      userLookup
+	maxLinkTTL time.Duration
+}
+
+func NewService(live, archive interfaces.RouteOwnerReader, shares interfaces.ShareRepository, users userLookup, maxLinkTTL time.Duration) *Service {
+	if maxLinkTTL <= 0 {
+		maxLinkTTL = 30 * 24 * time.Hour
+	}
+	return &Service{
+		live:       live,
+		archive:    archive,
+		shares:     shares,
+		users:      users,
+		maxLinkTTL: maxLinkTTL,
+	}
+}
+
+// Owner reads the owner from Redis while the route is live and from Mongo
+// once it has been archived.
+func (s *Service) Owner(ctx context.Context, routeID uuid.UUID) (uuid.UUID, error) {
+	if s.live != nil {
+		owner, err := s.live.GetRouteOwner(ctx, routeID)
+		if err == nil || !errors.Is(err, models.ErrRouteNotFound) {
+			return owner, err
+		}
+	}
+	if s.archive == nil {
+		return uuid.Nil, models.ErrRouteNotFound
+	}
+	return s.archive.GetRouteOwner(ctx, routeID)
+}
+
+// CanViewRoute reports whether userID owns the route or it was shared with
+// them. Routes without an owner are only readable with PermFleetRead, which
+// callers check before asking.
+func (s *Service) CanViewRoute(ctx context.Context, userID, routeID uuid.UUID) (bool, error) {
+	owner, err := s.Owner(ctx, routeID)
+	if err != nil {
+		return false, err
+	}
+	if owner == uuid.Nil {
+		return false, nil
+	}
+	if owner == userID {
+		return true, nil
+	}
+	return s.shares.HasShare(ctx, routeID, userID)
+}
+
+// OwnedRoutes lists the ids of the user's live and archived routes.
+func (s *Service) OwnedRoutes(ctx context.Context, ownerID uuid.UUID) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool)
+	ids := []uuid.UUID{}
+	for _, source := range []interfaces.RouteOwnerReader{s.live, s.archive} {
+		if source == nil {
+			continue
+		}
+		found, err := source.ListRouteIDsByOwner(ctx, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (s *Service) ShareWithUser(ctx context.Context, ownerID, routeID uuid.UUID, username string) (models.RouteShare, error) {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return models.RouteShare{}, err
+	}
+	if username == "" {
+		return models.RouteShare{}, fmt.Errorf("%w: username is required", ErrInvalidShare)
+	}
+	user, err := s.users.GetUserByUsername(ctx, username)
+	if err != nil {
+		return models.RouteShare{}, err
+	}
+	if user.UserID == ownerID {
+		return models.RouteShare{}, fmt.Errorf("%w: route is already yours", ErrInvalidShare)
+	}
+	share := models.RouteShare{
+		RouteID:   routeID,
+		UserID:    user.UserID,
+		CreatedBy: ownerID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.shares.CreateShare(ctx, share); err != nil {
+		return models.RouteShare{}, err
+	}
+	return share, nil
+}
+
+func (s *Service) Unshare(ctx context.Context, ownerID, routeID, userID uuid.UUID) error {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return err
+	}
+	return s.shares.DeleteShare(ctx, routeID, userID)
+}
+
+func (s *Service) Shares(ctx context.Context, ownerID, routeID uuid.UUID) ([]models.RouteShare, error) {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return nil, err
+	}
+	return s.shares.ListShares(ctx, routeID)
+}
+
+// CreateLink returns a new public link token for the route. The token is
+// not stored and cannot be shown again. A non-positive ttl selects one day.
+func (s *Service) CreateLink(ctx context.Context, ownerID, routeID uuid.UUID, ttl time.Duration) (string, models.ShareLink, error) {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return "", models.ShareLink{}, err
+	}
+	if ttl <= 0 {
+		ttl = defaultLinkTTL
+	}
+	if ttl > s.maxLinkTTL {
+		return "", models.ShareLink{}, fmt.Errorf("%w: ttl exceeds %s", ErrInvalidShare, s.maxLinkTTL)
+	}
+
+	raw := make([]byte, linkTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", models.ShareLink{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now().UTC()
+	link := models.ShareLink{
+		LinkID:    uuid.New(),
+		RouteID:   routeID,
+		TokenHash: hashToken(token),
+		CreatedBy: ownerID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.shares.CreateShareLink(ctx, link); err != nil {
+		return "", models.ShareLink{}, err
+	}
+	return token, link, nil
+}
+
+func (s *Service) Links(ctx context.Context, ownerID, routeID uuid.UUID) ([]models.ShareLink, error) {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return nil, err
+	}
+	return s.shares.ListShareLinks(ctx, routeID)
+}
+
+func (s *Service) RevokeLink(ctx context.Context, ownerID, routeID, linkID uuid.UUID) error {
+	if err := s.requireOwner(ctx, ownerID, routeID); err != nil {
+		return err
+	}
+	return s.shares.DeleteShareLink(ctx, routeID, linkID)
+}
+
+// ResolveLink returns the unexpired link for a public token.
+func (s *Service) ResolveLink(ctx context.Context, token string) (models.ShareLink, error) {
+	if token == "" {
+		return models.ShareLink{}, models.ErrShareNotFound
+	}
+	return s.shares.GetShareLinkByHash(ctx, hashToken(token))
+}
+
+func (s *Service) requireOwner(ctx context.Context, userID, routeID uuid.UUID) error {
+	owner, err := s.Owner(ctx, routeID)
+	if err != nil {
+		return err
+	}
+	if owner == uuid.Nil || owner != userID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
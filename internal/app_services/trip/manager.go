@@ -0,0 +1,205 @@
+package trip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gps/internal/app_services/aggregator"
+	"gps/internal/domain/interfaces"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+	"gps/pkg/conc"
+	"gps/pkg/ws"
+
+	"github.com/google/uuid"
+)
+
+// FinishHook is called with the device whose trip ended, the finished
+// route and its final aggregation.
+type FinishHook func(ctx context.Context, deviceID string, route models.Route, aggregated models.AggregatedData) error
+
+// ExpiredFinisher finishes routes whose live copy has already expired.
+type ExpiredFinisher interface {
+	FinishExpired(ctx context.Context, routeID uuid.UUID, endTime time.Time) (models.Route, error)
+}
+
+// OwnerLookup resolves the user a device belongs to.
+type OwnerLookup func(ctx context.Context, deviceID string) (uuid.UUID, error)
+
+// Manager opens and closes routes from the raw point stream of each device.
+// The Redis TTL on routes stays in place only as a safety net for devices
+// whose trips are never closed, e.g. after a crash.
+type Manager struct {
+	detector      *services.TripDetector
+	routes        interfaces.RedisRouteRepository
+	live          *aggregator.AggregatorService
+	aggregator    *services.Aggregator
+	notify        chan<- ws.WriteToWs
+	hooks         []FinishHook
+	sweepInterval time.Duration
+	expired       ExpiredFinisher
+
+	lookupOwner OwnerLookup
+	ownersMu    sync.Mutex
+	owners      map[string]uuid.UUID
+}
+
+func NewManager(
+	detector *services.TripDetector,
+	routes interfaces.RedisRouteRepository,
+	live *aggregator.AggregatorService,
+	aggregator *services.Aggregator,
+	notify chan<- ws.WriteToWs,
+	sweepInterval time.Duration,
+) *Manager {
+	if sweepInterval <= 0 {
+		sweepInterval = 30 * time.Second
+	}
+	return &Manager{
+		detector:      detector,
+		routes:        routes,
+		live:          live,
+		aggregator:    aggregator,
+		notify:        notify,
+		sweepInterval: sweepInterval,
+		owners:        make(map[string]uuid.UUID),
+	}
+}
+
+// WithArchive finishes trips in the archive when the live route expired
+// before the trip ended.
+func (m *Manager) WithArchive(expired ExpiredFinisher) {
+	m.expired = expired
+}
+
+// WithOwners resolves the owner of a device whenever it starts a trip and
+// records it on the new route. Without an owner a route is only visible to
+// fleet readers.
+func (m *Manager) WithOwners(lookup OwnerLookup) {
+	m.lookupOwner = lookup
+}
+
+func (m *Manager) OnFinish(hook FinishHook) {
+	m.hooks = append(m.hooks, hook)
+}
+
+func (m *Manager) CurrentRoute(deviceID string) (uuid.UUID, bool) {
+	return m.detector.CurrentRoute(deviceID)
+}
+
+// CurrentOwner returns the owner resolved when the device last started a
+// trip, or uuid.Nil if it is unknown.
+func (m *Manager) CurrentOwner(deviceID string) uuid.UUID {
+	m.ownersMu.Lock()
+	defer m.ownersMu.Unlock()
+	return m.owners[deviceID]
+}
+
+func (m *Manager) HandlePoint(ctx context.Context, deviceID string, point models.GPSData) error {
+	for _, event := range m.detector.Process(deviceID, point) {
+		if err := m.apply(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run closes the trips of silent devices until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := conc.NewTicker()
+	ticker.Start(ctx, m.sweepInterval, func() {
+		for _, event := range m.detector.Expire(time.Now()) {
+			if err := m.apply(ctx, event); err != nil {
+				slog.Error("Failed to finish idle trip", "route_id", event.RouteID, "device_id", event.DeviceID, "error", err)
+			}
+		}
+	})
+}
+
+func (m *Manager) apply(ctx context.Context, event models.TripEvent) error {
+	switch event.Type {
+	case models.TripStarted:
+		slog.Info("Trip started", "route_id", event.RouteID, "device_id", event.DeviceID)
+		owner := m.resolveOwner(ctx, event.DeviceID)
+		if _, err := m.live.AppendPoint(ctx, event.RouteID, event.Point); err != nil {
+			return err
+		}
+		if owner == uuid.Nil {
+			return nil
+		}
+		return m.routes.SetRouteOwner(ctx, event.RouteID, owner)
+	case models.TripPoint:
+		if _, err := m.live.AppendPoint(ctx, event.RouteID, event.Point); err != nil {
+			return err
+		}
+		return m.publish(ctx, event.RouteID, event.Point)
+	case models.TripFinished:
+		return m.finish(ctx, event)
+	}
+	return nil
+}
+
+// resolveOwner refreshes the device's owner once per trip rather than per
+// point. A failed lookup leaves the trip unowned.
+func (m *Manager) resolveOwner(ctx context.Context, deviceID string) uuid.UUID {
+	if m.lookupOwner == nil {
+		return uuid.Nil
+	}
+	owner, err := m.lookupOwner(ctx, deviceID)
+	if err != nil {
+		slog.Warn("Failed to resolve device owner", "device_id", deviceID, "error", err)
+		owner = uuid.Nil
+	}
+	m.ownersMu.Lock()
+	m.owners[deviceID] = owner
+	m.ownersMu.Unlock()
+	return owner
+}
+
+func (m *Manager) finish(ctx context.Context, event models.TripEvent) error {
+	route, err := m.finishRoute(ctx, event)
+	if err != nil {
+		return err
+	}
+	aggregated := m.aggregator.AggregateRoute(route)
+	slog.Info("Trip finished", "route_id", event.RouteID, "device_id", event.DeviceID,
+		"distance", aggregated.TotalDistance, "points", aggregated.AmountPoints)
+
+	for _, hook := range m.hooks {
+		if err := hook(ctx, event.DeviceID, route, aggregated); err != nil {
+			return err
+		}
+	}
+	return m.publish(ctx, event.RouteID, aggregated)
+}
+
+func (m *Manager) finishRoute(ctx context.Context, event models.TripEvent) (models.Route, error) {
+	err := m.routes.FinishRoute(ctx, event.RouteID, event.EndTime)
+	if errors.Is(err, models.ErrRouteNotFound) && m.expired != nil {
+		return m.expired.FinishExpired(ctx, event.RouteID, event.EndTime)
+	}
+	if err != nil {
+		return models.Route{}, err
+	}
+	return m.routes.GetRoute(ctx, event.RouteID)
+}
+
+func (m *Manager) publish(ctx context.Context, routeID uuid.UUID, payload any) error {
+	if m.notify == nil {
+		return nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case m.notify <- ws.WriteToWs{Payload: raw, ConsumerID: routeID}:
+		return nil
+	}
+}
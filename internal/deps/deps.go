@@ -2,11 +2,29 @@ package deps
 
 import (
 	"context"
+	"errors"
+	"gps/internal/adapters/api/middleware"
+	"gps/internal/adapters/broadcast"
 	"gps/internal/adapters/repo/mongoDb"
 	redisRepo "gps/internal/adapters/repo/redis"
+	"gps/internal/adapters/roadgraph"
+	"gps/internal/adapters/stream"
 	"gps/internal/app_services/aggregator"
+	"gps/internal/app_services/archiver"
+	"gps/internal/app_services/auth"
+	"gps/internal/app_services/device"
+	"gps/internal/app_services/geofence"
+	"gps/internal/app_services/ingest"
+	"gps/internal/app_services/rollup"
+	"gps/internal/app_services/route"
+	"gps/internal/app_services/sharing"
+	"gps/internal/app_services/trip"
 	"gps/internal/config"
-	"time"
+	"gps/internal/domain/models"
+	"gps/internal/domain/services"
+	"gps/pkg/exchanger"
+	"gps/pkg/ws"
+	"log/slog"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -16,10 +34,30 @@ import (
 type Deps struct {
 	MongoClient *mongo.Client
 	RedisClient *redis.Client
-	MongoRepo       *mongoDb.Repository
+	MongoRepo   *mongoDb.Repository
 	Redis       *redisRepo.Repository
-	Aggregator *aggregator.AggregatorService
-	
+	Aggregator  *aggregator.AggregatorService
+	Geofences   *geofence.Service
+	MapMatcher  *services.MapMatcher
+	Smoother    *services.KalmanSmoother
+	Distance    services.DistanceStrategy
+	Rollups     *rollup.Service
+	Trips       *trip.Manager
+	Archiver    *archiver.Archiver
+	Routes      *route.Service
+	Sharing     *sharing.Service
+	Devices     *device.Service
+	Ingest      *ingest.Service
+	Pool        *exchanger.Pool[models.GPSData]
+	// StreamPublisher and StreamConsumer are nil unless the stream bus is
+	// enabled; the pool then feeds ingest directly.
+	StreamPublisher *stream.Publisher[models.GPSData]
+	StreamConsumer  *stream.Consumer[models.GPSData]
+	// Broker is nil unless websocket cluster broadcast is enabled.
+	Broker *broadcast.RedisBroker
+	Auth   *auth.AuthService
+	// AuthClient backs the HTTP auth middleware.
+	AuthClient middleware.AuthClient
 }
 type option func(*Deps) error
 
@@ -34,25 +72,309 @@ func NewDeps(opts ...option) (*Deps, error) {
 }
 func WithMongoRepo(config config.Config) option {
 	return func(d *Deps) error {
-		repo, err := mongoDb.NewRepository(context.Background(), d.MongoClient, config.Mongo.Database)
+		repo, err := mongoDb.NewRepository(context.Background(), d.MongoClient, config.Mongo.Database, mongoDb.WithBucketSize(config.Mongo.BucketSize))
 		if err != nil {
 			return err
 		}
+		// Unmigrated routes stay readable from their embedded path, so the
+		// move into buckets does not hold up startup.
+		go func() {
+			migrated, err := repo.MigrateEmbeddedPaths(context.Background())
+			if err != nil {
+				slog.Error("Failed to migrate embedded route paths", "migrated", migrated, "error", err)
+				return
+			}
+			if migrated > 0 {
+				slog.Info("Migrated embedded route paths", "migrated", migrated)
+			}
+		}()
 		d.MongoRepo = repo
 		return nil
 	}
 }
 func WithRedisRepo(config config.Config) option {
 	return func(d *Deps) error {
-		repo, err := redisRepo.NewRepository(d.RedisClient, 5*time.Minute)
+		repo, err := redisRepo.NewRepository(d.RedisClient, config.Redis.RouteTTL)
 		if err != nil {
 			return err
 		}
+		// Legacy members stay readable, so the rewrite does not hold up
+		// startup.
+		go func() {
+			migrated, err := repo.MigratePointEncoding(context.Background())
+			if err != nil {
+				slog.Error("Failed to migrate route point encoding", "migrated", migrated, "error", err)
+				return
+			}
+			if migrated > 0 {
+				slog.Info("Migrated route point encoding", "migrated", migrated)
+			}
+		}()
 		d.Redis = repo
 		return nil
 	}
 }
 
+func WithGeofenceService(ctx context.Context, config config.Config, notify chan<- ws.WriteToWs) option {
+	return func(d *Deps) error {
+		engine := services.NewGeofenceEngine(config.Geofence.GridCellDegrees)
+		svc := geofence.NewService(d.MongoRepo, engine, notify)
+		if err := svc.Load(ctx); err != nil {
+			return err
+		}
+		d.Geofences = svc
+		return nil
+	}
+}
+
+// WithMapMatcher loads the road graph from disk. It is a no-op when no graph
+// path is configured.
+func WithMapMatcher(config config.Config) option {
+	return func(d *Deps) error {
+		if config.MapMatch.GraphPath == "" {
+			return nil
+		}
+		graph, err := roadgraph.Load(config.MapMatch.GraphPath)
+		if err != nil {
+			return err
+		}
+		d.MapMatcher = services.NewMapMatcher(graph, services.MapMatchParams{
+			SearchRadius: config.MapMatch.SearchRadius,
+			GPSSigma:     config.MapMatch.GPSSigma,
+			Beta:         config.MapMatch.Beta,
+		})
+		return nil
+	}
+}
+
+// WithKalmanSmoother enables position smoothing when KALMAN_ENABLED is set.
+func WithKalmanSmoother(config config.Config) option {
+	return func(d *Deps) error {
+		if !config.Kalman.Enabled {
+			return nil
+		}
+		d.Smoother = services.NewKalmanSmoother(services.KalmanParams{
+			ProcessNoise:     config.Kalman.ProcessNoise,
+			MeasurementNoise: config.Kalman.MeasurementNoise,
+			MaxGap:           config.Kalman.MaxGap,
+		})
+		return nil
+	}
+}
+
+func WithDistanceStrategy(config config.Config) option {
+	return func(d *Deps) error {
+		strategy, err := services.NewDistanceStrategy(config.Distance.Model, config.Distance.ThreeD)
+		if err != nil {
+			return err
+		}
+		d.Distance = strategy
+		return nil
+	}
+}
+
+func WithAggregatorService() option {
+	return func(d *Deps) error {
+		d.Aggregator = aggregator.NewAggregatorService(d.Redis, services.NewAggregator(services.WithDistanceStrategy(d.Distance)))
+		return nil
+	}
+}
+
+func WithRollupService(config config.Config) option {
+	return func(d *Deps) error {
+		builder := services.NewRollupBuilder(d.Distance, config.Rollup.BucketSize, config.Rollup.MaxGap)
+		d.Rollups = rollup.NewService(d.MongoRepo, builder, config.Rollup.FlushInterval)
+		return nil
+	}
+}
+
+// WithTripManager must come after WithAggregatorService and, when used,
+// WithRollupService and WithDeviceService. Rollups are attributed to the
+// device's current route and to the owner from the device registry.
+func WithTripManager(config config.Config, notify chan<- ws.WriteToWs) option {
+	return func(d *Deps) error {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+		detector := services.NewTripDetector(services.TripParams{
+			MinMovingSpeed: config.Trip.MinMovingSpeed,
+			IdleTimeout:    config.Trip.IdleTimeout,
+			MaxGap:         config.Trip.MaxGap,
+		}, d.Distance)
+		final := services.NewAggregator(services.WithDistanceStrategy(d.Distance))
+		d.Trips = trip.NewManager(detector, d.Redis, d.Aggregator, final, notify, config.Trip.SweepInterval)
+		if d.Devices != nil {
+			d.Trips.WithOwners(d.Devices.Owner)
+		}
+
+		if d.Rollups != nil {
+			d.Rollups.WithAttribution(func(deviceID string) models.RollupKey {
+				routeID, _ := d.Trips.CurrentRoute(deviceID)
+				return models.RollupKey{DeviceID: deviceID, RouteID: routeID, UserID: d.Trips.CurrentOwner(deviceID)}
+			})
+		}
+		return nil
+	}
+}
+
+// WithIngestService feeds every point through the smoother, when enabled,
+// to the trip manager, geofences and rollups. It must come after the
+// options that build those. The smoother forgets a device when its trip
+// ends so per-device state does not outlive the trip.
+func WithIngestService() option {
+	return func(d *Deps) error {
+		var handlers []ingest.PointHandler
+		if d.Trips != nil {
+			handlers = append(handlers, d.Trips)
+		}
+		if d.Geofences != nil {
+			handlers = append(handlers, d.Geofences)
+		}
+		if d.Rollups != nil {
+			handlers = append(handlers, d.Rollups)
+		}
+		d.Ingest = ingest.NewService(handlers...)
+		if d.Smoother != nil {
+			d.Ingest.WithFilters(d.Smoother)
+			if d.Trips != nil {
+				d.Trips.OnFinish(func(_ context.Context, deviceID string, _ models.Route, _ models.AggregatedData) error {
+					d.Smoother.Forget(deviceID)
+					return nil
+				})
+			}
+		}
+		return nil
+	}
+}
+
+// WithArchiver must come after WithTripManager so trips whose live route
+// expired are finished in the archive.
+func WithArchiver(config config.Config) option {
+	return func(d *Deps) error {
+		d.Archiver = archiver.NewArchiver(d.Redis, d.MongoRepo, config.Archive.Interval, config.Archive.Lease, config.Archive.Batch)
+		if d.Trips != nil {
+			d.Trips.WithArchive(d.Archiver)
+		}
+		return nil
+	}
+}
+
+func WithRouteService() option {
+	return func(d *Deps) error {
+		d.Routes = route.NewService(d.Redis, d.MongoRepo)
+		if d.Smoother != nil {
+			d.Routes.WithSmoother(d.Smoother)
+		}
+		return nil
+	}
+}
+
+func WithSharingService(config config.Config) option {
+	return func(d *Deps) error {
+		d.Sharing = sharing.NewService(d.Redis, d.MongoRepo, d.MongoRepo, d.MongoRepo, config.App.ShareLinkMaxTTL)
+		return nil
+	}
+}
+
+func WithDeviceService() option {
+	return func(d *Deps) error {
+		d.Devices = device.NewService(d.MongoRepo)
+		return nil
+	}
+}
+
+// WithExchangerPool must come after WithDeviceService so live trackers have
+// to present their device key before they stream.
+func WithExchangerPool(config config.Config) option {
+	return func(d *Deps) error {
+		d.Pool = exchanger.NewPool[models.GPSData](config.App.NumExchangers)
+		if d.Devices != nil {
+			d.Pool.SetAuthenticator(d.Devices.Verify)
+		}
+		return nil
+	}
+}
+
+func WithStreamBus(config config.Config) option {
+	return func(d *Deps) error {
+		if !config.Stream.Enabled {
+			return nil
+		}
+		publisher, err := stream.NewPublisher[models.GPSData](d.RedisClient, config.Stream.Name, config.Stream.MaxLen)
+		if err != nil {
+			return err
+		}
+		consumer, err := stream.NewConsumer[models.GPSData](d.RedisClient, config.Stream.Name, config.Stream.Group, config.Stream.Consumer, stream.ConsumerParams{
+			Batch:         100,
+			Block:         config.Stream.Block,
+			MinIdle:       config.Stream.MinIdle,
+			MaxDeliveries: config.Stream.MaxDeliveries,
+			DeadLetter:    config.Stream.DeadLetter,
+		})
+		if err != nil {
+			return err
+		}
+		d.StreamPublisher = publisher
+		d.StreamConsumer = consumer
+		return nil
+	}
+}
+
+func WithBroadcast(ctx context.Context, config config.Config) option {
+	return func(d *Deps) error {
+		if !config.App.ClusterBroadcast {
+			return nil
+		}
+		broker, err := broadcast.NewRedisBroker(ctx, d.RedisClient)
+		if err != nil {
+			return err
+		}
+		d.Broker = broker
+		return nil
+	}
+}
+
+func WithAuthService(config config.Config) option {
+	return func(d *Deps) error {
+		signer, err := auth.NewSignerFromConfig(config.JWT)
+		if err != nil {
+			return err
+		}
+		opts := []auth.AuthOption{
+			auth.WithDefaultRole(models.Role(config.Auth.DefaultRole)),
+			auth.WithRefreshTokens(d.MongoRepo, config.JWT.RefreshExpiry),
+		}
+		if d.Redis != nil {
+			opts = append(opts, auth.WithDenylist(d.Redis))
+		}
+		d.Auth = auth.NewAuthService(d.MongoRepo, signer, opts...)
+		if admin := config.Auth.BootstrapAdmin; admin != "" {
+			err := d.Auth.PromoteAdmin(context.Background(), admin)
+			if errors.Is(err, auth.ErrUserNotFound) {
+				slog.Warn("Bootstrap admin does not exist yet; sign up and restart", "username", admin)
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithAuthClient validates tokens in-process when this binary runs the auth
+// service and no remote validate URL is configured; otherwise it calls the
+// remote endpoint through an optional cache.
+func WithAuthClient(config config.Config) option {
+	return func(d *Deps) error {
+		if d.Auth != nil && config.Auth.ValidateURL == "" && !config.Auth.Disabled {
+			d.AuthClient = middleware.NewLocalAuthClient(d.Auth)
+			return nil
+		}
+		d.AuthClient = middleware.NewBaseAuthClient(config.Auth.ValidateURL, "", config.Auth.Disabled,
+			middleware.WithValidationCache(config.Auth.CacheSize, config.Auth.CacheTTL))
+		return nil
+	}
+}
+
 func WithMongoClient(ctx context.Context, config config.Config) option {
 	return func(d *Deps) error {
 		client, err := mongo.Connect(options.Client().ApplyURI(config.Mongo.URI))
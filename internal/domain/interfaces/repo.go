@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"gps/internal/domain/models"
 
@@ -13,11 +14,36 @@ type RouteRepository interface {
 	GetRouteByID(ctx context.Context, routeID uuid.UUID) (models.Route, error)
 	AddGPSDataToRoute(ctx context.Context, routeID uuid.UUID, gps models.GPSData) error
 	GetGPSDataLastNSeconds(ctx context.Context, seconds int) ([]models.GPSData, error)
+	RouteRangeReader
+	RoutePathPager
+	RouteOwnerReader
+}
+
+// RouteRangeReader reads points by timestamp without loading whole routes.
+// A zero from or to leaves that side of the range open.
+type RouteRangeReader interface {
+	GetRoutePathRange(ctx context.Context, routeID uuid.UUID, from, to time.Time) ([]models.GPSData, error)
+	GetPointsSince(ctx context.Context, since time.Time) ([]models.RoutePosition, error)
+}
+
+// RouteOwnerReader looks up route ownership. Routes stored without an
+// owner report uuid.Nil.
+type RouteOwnerReader interface {
+	GetRouteOwner(ctx context.Context, routeID uuid.UUID) (uuid.UUID, error)
+	ListRouteIDsByOwner(ctx context.Context, ownerID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// RoutePathPager pages through a route path by timestamp. At most limit
+// points after the cursor are returned.
+type RoutePathPager interface {
+	GetRoutePathPage(ctx context.Context, routeID uuid.UUID, after models.PathCursor, limit int) (models.PathPage, error)
 }
 
 type UserRepository interface {
-	CreateUser(ctx context.Context, username, passwordHash string) (uuid.UUID, error)
+	CreateUser(ctx context.Context, username, passwordHash string, roles []models.Role) (uuid.UUID, error)
 	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (models.User, error)
+	UpdateUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, permissions []models.Permission) error
 }
 
 type RedisRouteRepository interface {
@@ -26,4 +52,96 @@ type RedisRouteRepository interface {
 	GetRoute(ctx context.Context, routeID uuid.UUID) (models.Route, error)
 	GetRoutePath(ctx context.Context, routeID uuid.UUID) ([]models.GPSData, error)
 	DeleteRoute(ctx context.Context, routeID uuid.UUID) error
+	FinishRoute(ctx context.Context, routeID uuid.UUID, endTime time.Time) error
+	SetRouteOwner(ctx context.Context, routeID, ownerID uuid.UUID) error
+	AppendRoutePointWithStats(ctx context.Context, routeID uuid.UUID, point models.GPSData, fold func(*models.RouteStats) bool) (models.RouteStats, error)
+	GetRouteStats(ctx context.Context, routeID uuid.UUID) (models.RouteStats, error)
+	ClaimDueRoutes(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]uuid.UUID, error)
+	ReleaseDueRoute(ctx context.Context, routeID uuid.UUID) error
+	PruneActiveIndex(ctx context.Context, now time.Time) (int64, error)
+	RouteRangeReader
+	RoutePathPager
+	RouteOwnerReader
+}
+
+type RouteArchive interface {
+	UpsertRoute(ctx context.Context, route models.Route) error
+	GetRouteByID(ctx context.Context, routeID uuid.UUID) (models.Route, error)
+	FinishArchivedRoute(ctx context.Context, routeID uuid.UUID, endTime time.Time) error
+}
+
+type GeofenceRepository interface {
+	CreateGeofence(ctx context.Context, fence models.Geofence) error
+	ListGeofences(ctx context.Context) ([]models.Geofence, error)
+	DeleteGeofence(ctx context.Context, fenceID uuid.UUID) error
+	StoreGeofenceEvents(ctx context.Context, events []models.GeofenceEvent) error
+	GetGeofenceEvents(ctx context.Context, fenceID uuid.UUID, limit int) ([]models.GeofenceEvent, error)
+}
+
+// SpatialRouteRepository finds routes by where their points lie. The route
+// queries return metadata only; Path is left empty.
+type SpatialRouteRepository interface {
+	GetRoutesNear(ctx context.Context, loc models.Location, maxMeters float64) ([]models.Route, error)
+	GetRoutesInBoundingBox(ctx context.Context, box models.BoundingBox) ([]models.Route, error)
+	GetRoutesIntersecting(ctx context.Context, polygon []models.Location) ([]models.Route, error)
+	GetLastPositionsNear(ctx context.Context, loc models.Location, maxMeters float64, limit int) ([]models.RoutePosition, error)
+}
+
+type RollupRepository interface {
+	// StoreRollups writes rollups in order and returns how many were stored;
+	// on error the rest were not.
+	StoreRollups(ctx context.Context, rollups []models.Rollup) (int, error)
+	QueryRollups(ctx context.Context, query models.RollupQuery) ([]models.RollupResult, error)
+}
+
+type ShareRepository interface {
+	CreateShare(ctx context.Context, share models.RouteShare) error
+	DeleteShare(ctx context.Context, routeID, userID uuid.UUID) error
+	ListShares(ctx context.Context, routeID uuid.UUID) ([]models.RouteShare, error)
+	HasShare(ctx context.Context, routeID, userID uuid.UUID) (bool, error)
+	CreateShareLink(ctx context.Context, link models.ShareLink) error
+	GetShareLinkByHash(ctx context.Context, tokenHash string) (models.ShareLink, error)
+	ListShareLinks(ctx context.Context, routeID uuid.UUID) ([]models.ShareLink, error)
+	DeleteShareLink(ctx context.Context, routeID, linkID uuid.UUID) error
+}
+
+type DeviceRepository interface {
+	CreateDevice(ctx context.Context, device models.Device) error
+	GetDevice(ctx context.Context, deviceID uuid.UUID) (models.Device, error)
+	GetDeviceByIMEI(ctx context.Context, imei string) (models.Device, error)
+	ListDevices(ctx context.Context) ([]models.Device, error)
+	// UpdateDevice rewrites the owner, vehicle and protocol; the IMEI and
+	// key are left alone.
+	UpdateDevice(ctx context.Context, device models.Device) error
+	SetDeviceKey(ctx context.Context, deviceID uuid.UUID, keyHash string) error
+	DeleteDevice(ctx context.Context, deviceID uuid.UUID) error
+}
+
+type RefreshTokenRepository interface {
+	StoreRefreshToken(ctx context.Context, token models.RefreshToken) error
+	// UseRefreshToken atomically marks an unexpired token as used and
+	// returns it. A token that was already used or revoked is returned
+	// together with ErrTokenReused.
+	UseRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	// GetRefreshToken returns a token in any state without consuming it.
+	GetRefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error
+}
+
+type TokenDenylist interface {
+	DenyToken(ctx context.Context, jti string, until time.Time) error
+	IsTokenDenied(ctx context.Context, jti string) (bool, error)
+}
+
+// IdempotencyStore remembers the response to a request by key so a retried
+// request is answered again instead of being applied twice.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims key for ttl. If the key already holds a
+	// completed response, that response is returned and reserved is false.
+	// If another request holds the claim, both are empty.
+	ReserveIdempotencyKey(ctx context.Context, key string, ttl time.Duration) (response []byte, reserved bool, err error)
+	CompleteIdempotencyKey(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	// ReleaseIdempotencyKey drops a claim whose request failed so it can be
+	// retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device is a registered tracker. IMEI is the id the tracker reports and
+// the device id used by the ingest pipeline. Only a hash of the device API
+// key is stored; the key itself is shown once when it is issued.
+type Device struct {
+	DeviceID  uuid.UUID `json:"device_id" bson:"device_id"`
+	IMEI      string    `json:"imei" bson:"imei"`
+	OwnerID   uuid.UUID `json:"owner_id,omitzero" bson:"owner_id"`
+	VehicleID string    `json:"vehicle_id,omitempty" bson:"vehicle_id,omitempty"`
+	Protocol  string    `json:"protocol,omitempty" bson:"protocol,omitempty"`
+	KeyHash   string    `json:"-" bson:"key_hash"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
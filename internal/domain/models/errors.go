@@ -0,0 +1,17 @@
+package models
+
+import "errors"
+
+var (
+	ErrRouteNotFound      = errors.New("route not found")
+	ErrDuplicateRoute     = errors.New("route already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrDuplicateUsername  = errors.New("username already taken")
+	ErrShareNotFound      = errors.New("share not found")
+	ErrTokenNotFound      = errors.New("refresh token not found")
+	ErrTokenReused        = errors.New("refresh token reused")
+	ErrDeviceNotFound     = errors.New("device not found")
+	ErrDuplicateDevice    = errors.New("device already registered")
+	ErrInvalidPoint       = errors.New("invalid point")
+	ErrInvalidRollupQuery = errors.New("invalid rollup query")
+)
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GeofenceType string
+
+const (
+	GeofenceCircle  GeofenceType = "circle"
+	GeofencePolygon GeofenceType = "polygon"
+)
+
+type Geofence struct {
+	FenceID   uuid.UUID     `json:"fence_id" bson:"fence_id"`
+	Name      string        `json:"name" bson:"name"`
+	Type      GeofenceType  `json:"type" bson:"type"`
+	Center    Location      `json:"center,omitempty" bson:"center,omitempty"`
+	Radius    float64       `json:"radius,omitempty" bson:"radius,omitempty"`
+	Polygon   []Location    `json:"polygon,omitempty" bson:"polygon,omitempty"`
+	DwellTime time.Duration `json:"dwell_time" bson:"dwell_time"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+type GeofenceEventType string
+
+const (
+	GeofenceEnter GeofenceEventType = "enter"
+	GeofenceExit  GeofenceEventType = "exit"
+	GeofenceDwell GeofenceEventType = "dwell"
+)
+
+type GeofenceEvent struct {
+	EventID   uuid.UUID         `json:"event_id" bson:"event_id"`
+	FenceID   uuid.UUID         `json:"fence_id" bson:"fence_id"`
+	DeviceID  string            `json:"device_id" bson:"device_id"`
+	Type      GeofenceEventType `json:"type" bson:"type"`
+	Location  Location          `json:"location" bson:"location"`
+	Timestamp time.Time         `json:"timestamp" bson:"timestamp"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,6 +13,26 @@ type GPSData struct {
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 }
 
+// maxClockSkew is how far in the future a device clock may run before its
+// points are rejected.
+const maxClockSkew = 5 * time.Minute
+
+// Validate rejects points that cannot be real fixes: coordinates out of
+// range, a missing timestamp, or one from the future.
+func (g GPSData) Validate(now time.Time) error {
+	switch {
+	case math.IsNaN(g.Location.Latitude) || g.Location.Latitude < -90 || g.Location.Latitude > 90:
+		return fmt.Errorf("%w: latitude out of range", ErrInvalidPoint)
+	case math.IsNaN(g.Location.Longitude) || g.Location.Longitude < -180 || g.Location.Longitude > 180:
+		return fmt.Errorf("%w: longitude out of range", ErrInvalidPoint)
+	case g.Timestamp.IsZero():
+		return fmt.Errorf("%w: timestamp is required", ErrInvalidPoint)
+	case g.Timestamp.After(now.Add(maxClockSkew)):
+		return fmt.Errorf("%w: timestamp is in the future", ErrInvalidPoint)
+	}
+	return nil
+}
+
 type Location struct {
 	Latitude  float64 `json:"latitude" bson:"latitude"`
 	Longitude float64 `json:"longitude" bson:"longitude"`
@@ -19,6 +41,7 @@ type Location struct {
 
 type Route struct {
 	RouteID   uuid.UUID `json:"route_id" bson:"route_id"`
+	OwnerID   uuid.UUID `json:"owner_id" bson:"owner_id"`
 	Path      []GPSData `json:"path" bson:"path"`
 	StartTime time.Time `json:"start_time" bson:"start_time"`
 	Finished  bool      `json:"finished" bson:"finished"`
@@ -0,0 +1,11 @@
+package models
+
+import "github.com/google/uuid"
+
+type MatchedRoute struct {
+	RouteID       uuid.UUID  `json:"route_id"`
+	Geometry      []Location `json:"geometry"`
+	RoadDistance  float64    `json:"road_distance"`
+	MatchedPoints int        `json:"matched_points"`
+	SkippedPoints int        `json:"skipped_points"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PathCursor is the position after the last point of a page. Timestamps are
+// not unique, so Skip counts the points at Timestamp that were already
+// returned; a store resumes at the first point with timestamp >= Timestamp
+// and skips that many.
+type PathCursor struct {
+	Timestamp time.Time
+	Skip      int
+}
+
+func (c PathCursor) IsZero() bool {
+	return c.Timestamp.IsZero() && c.Skip == 0
+}
+
+// String is the RFC 3339 timestamp, followed by ",<skip>" when Skip is set.
+func (c PathCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	ts := c.Timestamp.UTC().Format(time.RFC3339Nano)
+	if c.Skip == 0 {
+		return ts
+	}
+	return ts + "," + strconv.Itoa(c.Skip)
+}
+
+// ParsePathCursor reads the String form of a cursor. An empty string is the
+// start of the path.
+func ParsePathCursor(raw string) (PathCursor, error) {
+	if raw == "" {
+		return PathCursor{}, nil
+	}
+	ts, skip, found := strings.Cut(raw, ",")
+	parsed, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return PathCursor{}, ErrInvalidCursor
+	}
+	cursor := PathCursor{Timestamp: parsed}
+	if found {
+		n, err := strconv.Atoi(skip)
+		if err != nil || n < 0 {
+			return PathCursor{}, ErrInvalidCursor
+		}
+		cursor.Skip = n
+	}
+	return cursor, nil
+}
+
+func (c PathCursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *PathCursor) UnmarshalText(text []byte) error {
+	cursor, err := ParsePathCursor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = cursor
+	return nil
+}
+
+// PathPage is one page of a route path ordered by timestamp. NextCursor is
+// passed as the next "after" value; it is zero on the last page.
+type PathPage struct {
+	Points     []GPSData  `json:"points"`
+	NextCursor PathCursor `json:"next_cursor,omitzero"`
+}
+
+// NewPathPage builds a page from a read of up to limit+1 points that started
+// at after: the extra point only signals that another page exists and is
+// dropped.
+func NewPathPage(points []GPSData, limit int, after PathCursor) PathPage {
+	if len(points) <= limit {
+		return PathPage{Points: points}
+	}
+	points = points[:limit]
+	last := points[limit-1].Timestamp
+	skip := 0
+	for i := limit - 1; i >= 0 && points[i].Timestamp.Equal(last); i-- {
+		skip++
+	}
+	if skip == limit && after.Timestamp.Equal(last) {
+		skip += after.Skip
+	}
+	return PathPage{Points: points, NextCursor: PathCursor{Timestamp: last, Skip: skip}}
+}
@@ -0,0 +1,77 @@
+package models
+
+import "slices"
+
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleDispatcher Role = "dispatcher"
+	RoleDriver     Role = "driver"
+	RoleViewer     Role = "viewer"
+)
+
+type Permission string
+
+const (
+	// PermRoutesRead lets a user read routes they own or that are shared
+	// with them.
+	PermRoutesRead Permission = "routes:read"
+	// PermRoutesWrite lets a user create routes and post points.
+	PermRoutesWrite Permission = "routes:write"
+	// PermFleetRead lets a user read and watch every route and the fleet
+	// rollups and geofence events.
+	PermFleetRead        Permission = "fleet:read"
+	PermGeofencesManage  Permission = "geofences:manage"
+	PermExchangersManage Permission = "exchangers:manage"
+	PermUsersManage      Permission = "users:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:     {PermRoutesRead},
+	RoleDriver:     {PermRoutesRead, PermRoutesWrite},
+	RoleDispatcher: {PermRoutesRead, PermFleetRead, PermGeofencesManage},
+	RoleAdmin: {
+		PermRoutesRead, PermRoutesWrite, PermFleetRead,
+		PermGeofencesManage, PermExchangersManage, PermUsersManage,
+	},
+}
+
+// Valid reports whether p is granted by any role.
+func (p Permission) Valid() bool {
+	for _, perms := range rolePermissions {
+		if slices.Contains(perms, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Permissions() []Permission {
+	return rolePermissions[r]
+}
+
+// EffectivePermissions merges the permissions of the user's roles with the
+// ones granted to the user directly, without duplicates.
+func (u User) EffectivePermissions() []Permission {
+	var perms []Permission
+	add := func(p Permission) {
+		if !slices.Contains(perms, p) {
+			perms = append(perms, p)
+		}
+	}
+	for _, role := range u.Roles {
+		for _, p := range role.Permissions() {
+			add(p)
+		}
+	}
+	for _, p := range u.Permissions {
+		add(p)
+	}
+	return perms
+}
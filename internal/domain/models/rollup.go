@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RollupKey struct {
+	DeviceID string    `json:"device_id" bson:"device_id"`
+	RouteID  uuid.UUID `json:"route_id,omitempty" bson:"route_id,omitempty"`
+	UserID   uuid.UUID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+}
+
+// Rollup is one fixed-size time bucket of fleet activity. Several rollups
+// may exist for the same bucket and key when points arrive late; queries
+// sum them.
+type Rollup struct {
+	BucketStart   time.Time `json:"bucket_start" bson:"bucket_start"`
+	Meta          RollupKey `json:"meta" bson:"meta"`
+	Distance      float64   `json:"distance" bson:"distance"`
+	Points        int       `json:"points" bson:"points"`
+	MovingSeconds float64   `json:"moving_seconds" bson:"moving_seconds"`
+	MaxSpeed      float64   `json:"max_speed" bson:"max_speed"`
+}
+
+type RollupGroupBy string
+
+const (
+	GroupByDevice RollupGroupBy = "device"
+	GroupByRoute  RollupGroupBy = "route"
+	GroupByUser   RollupGroupBy = "user"
+)
+
+type RollupQuery struct {
+	From       time.Time
+	To         time.Time
+	BucketSize time.Duration
+	GroupBy    RollupGroupBy
+	DeviceID   string
+	RouteID    uuid.UUID
+	UserID     uuid.UUID
+}
+
+type RollupResult struct {
+	BucketStart   time.Time `json:"bucket_start" bson:"bucket_start"`
+	Group         string    `json:"group" bson:"group"`
+	Distance      float64   `json:"distance" bson:"distance"`
+	Points        int       `json:"points" bson:"points"`
+	MovingSeconds float64   `json:"moving_seconds" bson:"moving_seconds"`
+	MaxSpeed      float64   `json:"max_speed" bson:"max_speed"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RouteStats is the serializable state of a streaming route aggregation.
+// SpeedMean and SpeedM2 are Welford accumulators over per-segment speeds.
+type RouteStats struct {
+	RouteID       uuid.UUID `json:"route_id"`
+	FirstTime     time.Time `json:"first_time"`
+	LastPoint     GPSData   `json:"last_point"`
+	AmountPoints  int       `json:"amount_points"`
+	TotalDistance float64   `json:"total_distance"`
+	MaxSpeed      float64   `json:"max_speed"`
+	SpeedSamples  int       `json:"speed_samples"`
+	SpeedMean     float64   `json:"speed_mean"`
+	SpeedM2       float64   `json:"speed_m2"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RouteShare grants another user read access to a route.
+type RouteShare struct {
+	RouteID   uuid.UUID `json:"route_id" bson:"route_id"`
+	UserID    uuid.UUID `json:"user_id" bson:"user_id"`
+	CreatedBy uuid.UUID `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// ShareLink is a public, time-limited read link to a route. Only a hash of
+// the link token is stored; the token itself is shown once at creation.
+type ShareLink struct {
+	LinkID    uuid.UUID `json:"link_id" bson:"link_id"`
+	RouteID   uuid.UUID `json:"route_id" bson:"route_id"`
+	TokenHash string    `json:"-" bson:"token_hash"`
+	CreatedBy uuid.UUID `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
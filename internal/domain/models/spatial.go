@@ -0,0 +1,27 @@
+package models
+
+import "github.com/google/uuid"
+
+type BoundingBox struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+// Polygon returns the four corners of the box, counter-clockwise from the
+// south-west corner. The first corner is not repeated; callers that need a
+// closed ring, such as GeoJSON, close it themselves.
+func (b BoundingBox) Polygon() []Location {
+	return []Location{
+		{Latitude: b.MinLatitude, Longitude: b.MinLongitude},
+		{Latitude: b.MinLatitude, Longitude: b.MaxLongitude},
+		{Latitude: b.MaxLatitude, Longitude: b.MaxLongitude},
+		{Latitude: b.MaxLatitude, Longitude: b.MinLongitude},
+	}
+}
+
+type RoutePosition struct {
+	RouteID uuid.UUID `json:"route_id"`
+	GPSData
+}
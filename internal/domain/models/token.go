@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is the stored form of a refresh token. Tokens issued by
+// rotating one another share a FamilyID, so presenting a token that was
+// already used revokes the whole family.
+type RefreshToken struct {
+	TokenHash string    `bson:"token_hash"`
+	FamilyID  uuid.UUID `bson:"family_id"`
+	UserID    uuid.UUID `bson:"user_id"`
+	IssuedAt  time.Time `bson:"issued_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	Used      bool      `bson:"used"`
+	Revoked   bool      `bson:"revoked"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TripEventType string
+
+const (
+	TripStarted  TripEventType = "started"
+	TripPoint    TripEventType = "point"
+	TripFinished TripEventType = "finished"
+)
+
+type TripEvent struct {
+	Type     TripEventType
+	DeviceID string
+	RouteID  uuid.UUID
+	Point    GPSData
+	// EndTime is set on TripFinished and is the time of the last movement
+	// or the last fix before a data gap.
+	EndTime time.Time
+}
@@ -3,7 +3,9 @@ package models
 import "github.com/google/uuid"
 
 type User struct {
-	UserID       uuid.UUID `json:"id" bson:"id"`
-	Username     string    `json:"username" bson:"username"`
-	PasswordHash string    `json:"password" bson:"password"`
+	UserID       uuid.UUID    `json:"id" bson:"id"`
+	Username     string       `json:"username" bson:"username"`
+	PasswordHash string       `json:"password" bson:"password"`
+	Roles        []Role       `json:"roles" bson:"roles,omitempty"`
+	Permissions  []Permission `json:"permissions,omitempty" bson:"permissions,omitempty"`
 }
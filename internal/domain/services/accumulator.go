@@ -0,0 +1,91 @@
+package services
+
+import (
+	"math"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// RouteAccumulator folds points into route statistics one at a time, so
+// live dashboards do not have to re-aggregate the whole path on every fix.
+type RouteAccumulator struct {
+	stats    models.RouteStats
+	distance DistanceStrategy
+}
+
+func (a *Aggregator) NewAccumulator(routeID uuid.UUID) *RouteAccumulator {
+	return a.ResumeAccumulator(models.RouteStats{RouteID: routeID})
+}
+
+// ResumeAccumulator continues from stats persisted by another replica.
+func (a *Aggregator) ResumeAccumulator(stats models.RouteStats) *RouteAccumulator {
+	return &RouteAccumulator{stats: stats, distance: a.distance}
+}
+
+// Add folds point into the statistics. Points older than the last accepted
+// one are rejected, matching the timestamp ordering of the stored path, and
+// so are repeats of the last point: a device that resends a fix produces
+// the same timestamp at the same location.
+func (r *RouteAccumulator) Add(point models.GPSData) bool {
+	s := &r.stats
+	if s.AmountPoints == 0 {
+		s.FirstTime = point.Timestamp
+		s.LastPoint = point
+		s.AmountPoints = 1
+		return true
+	}
+	if point.Timestamp.Before(s.LastPoint.Timestamp) {
+		return false
+	}
+	if point.Timestamp.Equal(s.LastPoint.Timestamp) && point.Location == s.LastPoint.Location {
+		return false
+	}
+
+	segment := r.distance.Distance(s.LastPoint.Location, point.Location)
+	s.TotalDistance += segment
+	if seconds := point.Timestamp.Sub(s.LastPoint.Timestamp).Seconds(); seconds > 0 {
+		speed := segment / seconds
+		s.MaxSpeed = math.Max(s.MaxSpeed, speed)
+		s.SpeedSamples++
+		delta := speed - s.SpeedMean
+		s.SpeedMean += delta / float64(s.SpeedSamples)
+		s.SpeedM2 += delta * (speed - s.SpeedMean)
+	}
+	s.LastPoint = point
+	s.AmountPoints++
+	return true
+}
+
+func (r *RouteAccumulator) Stats() models.RouteStats {
+	return r.stats
+}
+
+// SpeedStdDev is the population standard deviation of segment speeds.
+func (r *RouteAccumulator) SpeedStdDev() float64 {
+	if r.stats.SpeedSamples == 0 {
+		return 0
+	}
+	return math.Sqrt(r.stats.SpeedM2 / float64(r.stats.SpeedSamples))
+}
+
+func (r *RouteAccumulator) Aggregated() models.AggregatedData {
+	s := r.stats
+	if s.AmountPoints == 0 {
+		return models.AggregatedData{RouteID: s.RouteID}
+	}
+	duration := s.LastPoint.Timestamp.Sub(s.FirstTime)
+	avgSpeed := 0.0
+	if seconds := duration.Seconds(); seconds > 0 {
+		avgSpeed = s.TotalDistance / seconds
+	}
+	return models.AggregatedData{
+		RouteID:       s.RouteID,
+		AverageSpeed:  avgSpeed,
+		TotalDistance: s.TotalDistance,
+		Duration:      duration,
+		AmountPoints:  s.AmountPoints,
+		Timestamp:     s.LastPoint.Timestamp,
+	}
+}
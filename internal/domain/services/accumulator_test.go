@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+func TestAccumulatorMatchesAggregateRoute(t *testing.T) {
+	start := time.Now()
+	var path []models.GPSData
+	for i := 0; i < 50; i++ {
+		path = append(path, models.GPSData{
+			Location:  models.Location{Latitude: 43.2 + float64(i)*0.0001, Longitude: 76.9 + float64(i*i)*0.00001},
+			Timestamp: start.Add(time.Duration(i) * 2 * time.Second),
+		})
+	}
+	route := models.Route{RouteID: uuid.New(), Path: path}
+	aggregator := NewAggregator()
+	want := aggregator.AggregateRoute(route)
+
+	acc := aggregator.NewAccumulator(route.RouteID)
+	for i, point := range path {
+		if i == 25 {
+			// Round-trip through JSON the way a different replica would.
+			raw, err := json.Marshal(acc.Stats())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stats models.RouteStats
+			if err := json.Unmarshal(raw, &stats); err != nil {
+				t.Fatal(err)
+			}
+			acc = aggregator.ResumeAccumulator(stats)
+		}
+		if !acc.Add(point) {
+			t.Fatalf("point %d unexpectedly rejected", i)
+		}
+	}
+
+	got := acc.Aggregated()
+	if got.AmountPoints != want.AmountPoints || got.Duration != want.Duration {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if math.Abs(got.TotalDistance-want.TotalDistance) > 1e-6 || math.Abs(got.AverageSpeed-want.AverageSpeed) > 1e-9 {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if acc.Stats().MaxSpeed < got.AverageSpeed {
+		t.Fatalf("max speed %.3f below average %.3f", acc.Stats().MaxSpeed, got.AverageSpeed)
+	}
+}
+
+func TestAccumulatorRejectsOutOfOrderPoints(t *testing.T) {
+	now := time.Now()
+	acc := NewAggregator().NewAccumulator(uuid.New())
+	acc.Add(models.GPSData{Timestamp: now})
+	if acc.Add(models.GPSData{Timestamp: now.Add(-time.Second)}) {
+		t.Fatalf("expected out-of-order point to be rejected")
+	}
+	if acc.Stats().AmountPoints != 1 {
+		t.Fatalf("expected rejected point not to be counted")
+	}
+}
+
+func TestAccumulatorRejectsDuplicatePoints(t *testing.T) {
+	now := time.Now()
+	location := models.Location{Latitude: 52.52, Longitude: 13.405}
+	acc := NewAggregator().NewAccumulator(uuid.New())
+	acc.Add(models.GPSData{Location: location, Timestamp: now})
+	if acc.Add(models.GPSData{Location: location, Timestamp: now}) {
+		t.Fatalf("expected duplicate point to be rejected")
+	}
+	if !acc.Add(models.GPSData{Location: models.Location{Latitude: 52.53, Longitude: 13.405}, Timestamp: now}) {
+		t.Fatalf("expected a new location at the same timestamp to be accepted")
+	}
+	if acc.Stats().AmountPoints != 2 {
+		t.Fatalf("expected 2 points, got %d", acc.Stats().AmountPoints)
+	}
+}
@@ -9,10 +9,27 @@ import (
 
 const earthRadiusMeters = 6371000.0
 
-type Aggregator struct{}
+type Aggregator struct {
+	distance DistanceStrategy
+}
+
+type AggregatorOption func(*Aggregator)
 
-func NewAggregator() *Aggregator {
-	return &Aggregator{}
+// WithDistanceStrategy overrides the default 3D haversine distance.
+func WithDistanceStrategy(strategy DistanceStrategy) AggregatorOption {
+	return func(a *Aggregator) {
+		if strategy != nil {
+			a.distance = strategy
+		}
+	}
+}
+
+func NewAggregator(opts ...AggregatorOption) *Aggregator {
+	a := &Aggregator{distance: WithAltitude(Haversine)}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *Aggregator) AggregateRoute(route models.Route) models.AggregatedData {
@@ -29,7 +46,7 @@ func (a *Aggregator) AggregateRoute(route models.Route) models.AggregatedData {
 	for i := 1; i < amountPoints; i++ {
 		prev := points[i-1]
 		curr := points[i]
-		totalDistance += distanceMeters(prev.Location, curr.Location)
+		totalDistance += a.distance.Distance(prev.Location, curr.Location)
 	}
 
 	startTime, endTime := a.resolveDurationBounds(route, points)
@@ -85,7 +102,7 @@ func (a *Aggregator) resolveTimestamp(route models.Route, fallback time.Time) ti
 	return time.Now()
 }
 
-func distanceMeters(aLoc, bLoc models.Location) float64 {
+func haversineMeters(aLoc, bLoc models.Location) float64 {
 	lat1 := toRadians(aLoc.Latitude)
 	lat2 := toRadians(bLoc.Latitude)
 	dLat := lat2 - lat1
@@ -96,13 +113,7 @@ func distanceMeters(aLoc, bLoc models.Location) float64 {
 
 	h := sinLat*sinLat + math.Cos(lat1)*math.Cos(lat2)*sinLon*sinLon
 	centralAngle := 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
-	horizontal := earthRadiusMeters * centralAngle
-
-	altDelta := bLoc.Altitude - aLoc.Altitude
-	if altDelta == 0 {
-		return horizontal
-	}
-	return math.Sqrt(horizontal*horizontal + altDelta*altDelta)
+	return earthRadiusMeters * centralAngle
 }
 
 func toRadians(deg float64) float64 {
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"gps/internal/domain/models"
+)
+
+const (
+	wgs84SemiMajor    = 6378137.0
+	wgs84Flattening   = 1 / 298.257223563
+	vincentyMaxIter   = 200
+	vincentyTolerance = 1e-12
+)
+
+// DistanceStrategy measures the distance in meters between two fixes.
+type DistanceStrategy interface {
+	Distance(a, b models.Location) float64
+}
+
+type DistanceFunc func(a, b models.Location) float64
+
+func (f DistanceFunc) Distance(a, b models.Location) float64 {
+	return f(a, b)
+}
+
+// Haversine treats the Earth as a sphere of radius earthRadiusMeters.
+// It is fast and within ~0.5% of the ellipsoidal distance.
+var Haversine DistanceStrategy = DistanceFunc(haversineMeters)
+
+// Vincenty solves the inverse geodesic problem on the WGS-84 ellipsoid.
+// For nearly antipodal points, where the iteration does not converge, it
+// falls back to the spherical distance.
+var Vincenty DistanceStrategy = DistanceFunc(vincentyMeters)
+
+type withAltitude struct {
+	base DistanceStrategy
+}
+
+// WithAltitude folds the altitude delta into the distance of base.
+func WithAltitude(base DistanceStrategy) DistanceStrategy {
+	return withAltitude{base: base}
+}
+
+func (w withAltitude) Distance(a, b models.Location) float64 {
+	horizontal := w.base.Distance(a, b)
+	altDelta := b.Altitude - a.Altitude
+	if altDelta == 0 {
+		return horizontal
+	}
+	return math.Sqrt(horizontal*horizontal + altDelta*altDelta)
+}
+
+// NewDistanceStrategy resolves a configured model name ("haversine" or
+// "vincenty") and optionally wraps it to account for altitude.
+func NewDistanceStrategy(model string, threeD bool) (DistanceStrategy, error) {
+	var base DistanceStrategy
+	switch model {
+	case "", "haversine":
+		base = Haversine
+	case "vincenty":
+		base = Vincenty
+	default:
+		return nil, fmt.Errorf("unknown distance model %q", model)
+	}
+	if threeD {
+		return WithAltitude(base), nil
+	}
+	return base, nil
+}
+
+func vincentyMeters(aLoc, bLoc models.Location) float64 {
+	if aLoc.Latitude == bLoc.Latitude && aLoc.Longitude == bLoc.Longitude {
+		return 0
+	}
+
+	a := wgs84SemiMajor
+	f := wgs84Flattening
+	b := a * (1 - f)
+
+	L := toRadians(bLoc.Longitude - aLoc.Longitude)
+	U1 := math.Atan((1 - f) * math.Tan(toRadians(aLoc.Latitude)))
+	U2 := math.Atan((1 - f) * math.Tan(toRadians(bLoc.Latitude)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for i := 0; i < vincentyMaxIter; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		t1 := cosU2 * sinLambda
+		t2 := cosU1*sinU2 - sinU1*cosU2*cosLambda
+		sinSigma = math.Sqrt(t1*t1 + t2*t2)
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return haversineMeters(aLoc, bLoc)
+	}
+
+	uSq := cosSqAlpha * (a*a - b*b) / (b * b)
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+	return b * A * (sigma - deltaSigma)
+}
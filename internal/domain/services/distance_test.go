@@ -0,0 +1,117 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"gps/internal/domain/models"
+)
+
+func dms(deg, min, sec float64) float64 {
+	sign := 1.0
+	if deg < 0 {
+		sign = -1
+		deg = -deg
+	}
+	return sign * (deg + min/60 + sec/3600)
+}
+
+// Reference distances on the WGS-84 (or, for the Geoscience Australia line,
+// the practically identical GRS-80) ellipsoid.
+var geodesicReference = []struct {
+	name     string
+	a, b     models.Location
+	expected float64
+	tol      float64
+}{
+	{
+		// Geoscience Australia worked example for Vincenty's inverse formula.
+		name:     "Flinders Peak to Buninyong",
+		a:        models.Location{Latitude: dms(-37, 57, 3.72030), Longitude: dms(144, 25, 29.52440)},
+		b:        models.Location{Latitude: dms(-37, 39, 10.15610), Longitude: dms(143, 55, 35.38390)},
+		expected: 54972.271,
+		tol:      0.001,
+	},
+	{
+		// One degree of longitude on the equator is a * pi / 180.
+		name:     "equator one degree",
+		a:        models.Location{Latitude: 0, Longitude: 0},
+		b:        models.Location{Latitude: 0, Longitude: 1},
+		expected: wgs84SemiMajor * math.Pi / 180,
+		tol:      0.001,
+	},
+	{
+		// WGS-84 quarter meridian.
+		name:     "equator to north pole",
+		a:        models.Location{Latitude: 0, Longitude: 0},
+		b:        models.Location{Latitude: 90, Longitude: 0},
+		expected: 10001965.729,
+		tol:      0.001,
+	},
+}
+
+func TestVincentyAgainstReferenceGeodesics(t *testing.T) {
+	for _, tc := range geodesicReference {
+		got := Vincenty.Distance(tc.a, tc.b)
+		if math.Abs(got-tc.expected) > tc.tol {
+			t.Fatalf("%s: expected %.4f, got %.4f", tc.name, tc.expected, got)
+		}
+		if back := Vincenty.Distance(tc.b, tc.a); math.Abs(back-got) > 1e-6 {
+			t.Fatalf("%s: distance is not symmetric: %.6f vs %.6f", tc.name, got, back)
+		}
+	}
+}
+
+func TestHaversineCloseToEllipsoid(t *testing.T) {
+	for _, tc := range geodesicReference {
+		got := Haversine.Distance(tc.a, tc.b)
+		if math.Abs(got-tc.expected)/tc.expected > 0.005 {
+			t.Fatalf("%s: haversine %.1f is more than 0.5%% off %.1f", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestVincentyNearlyAntipodalStaysFinite(t *testing.T) {
+	a := models.Location{Latitude: 0, Longitude: 0}
+	b := models.Location{Latitude: 0.5, Longitude: 179.7}
+	got := Vincenty.Distance(a, b)
+	if math.IsNaN(got) || got < 19000000 || got > 20100000 {
+		t.Fatalf("unexpected antipodal distance %.1f", got)
+	}
+}
+
+func TestDistanceStrategyAltitudeToggle(t *testing.T) {
+	a := models.Location{Latitude: 0, Longitude: 0, Altitude: 0}
+	b := models.Location{Latitude: 0, Longitude: 0, Altitude: 30}
+
+	flat, err := NewDistanceStrategy("vincenty", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := flat.Distance(a, b); got != 0 {
+		t.Fatalf("expected 2D distance to ignore altitude, got %.3f", got)
+	}
+
+	threeD, err := NewDistanceStrategy("vincenty", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := threeD.Distance(a, b); math.Abs(got-30) > 1e-9 {
+		t.Fatalf("expected 3D distance of 30, got %.3f", got)
+	}
+
+	if _, err := NewDistanceStrategy("flat-earth", false); err == nil {
+		t.Fatalf("expected an error for an unknown model")
+	}
+}
+
+func TestAggregatorUsesDistanceStrategy(t *testing.T) {
+	route := models.Route{Path: []models.GPSData{
+		{Location: geodesicReference[0].a},
+		{Location: geodesicReference[0].b},
+	}}
+	got := NewAggregator(WithDistanceStrategy(Vincenty)).AggregateRoute(route).TotalDistance
+	if math.Abs(got-geodesicReference[0].expected) > 0.001 {
+		t.Fatalf("expected aggregator to use Vincenty, got %.4f", got)
+	}
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	metersPerDegree        = 111320.0
+	defaultGridCellDegrees = 0.01
+	maxCellsPerFence       = 4096
+)
+
+type cellKey struct {
+	x int
+	y int
+}
+
+// GeofenceIndex is a uniform lat/lon grid that maps every cell to the fences
+// whose bounding box overlaps it. Fences spanning too many cells are kept in
+// a separate list that is checked for every point.
+type GeofenceIndex struct {
+	cellSize float64
+	cells    map[cellKey][]uuid.UUID
+	large    map[uuid.UUID]struct{}
+	fenceBox map[uuid.UUID][4]int
+}
+
+func NewGeofenceIndex(cellSize float64) *GeofenceIndex {
+	if cellSize <= 0 {
+		cellSize = defaultGridCellDegrees
+	}
+	return &GeofenceIndex{
+		cellSize: cellSize,
+		cells:    make(map[cellKey][]uuid.UUID),
+		large:    make(map[uuid.UUID]struct{}),
+		fenceBox: make(map[uuid.UUID][4]int),
+	}
+}
+
+func (i *GeofenceIndex) Insert(fence models.Geofence) {
+	i.Remove(fence.FenceID)
+
+	minLat, minLon, maxLat, maxLon := fenceBounds(fence)
+	x0, y0 := i.cell(minLat, minLon)
+	x1, y1 := i.cell(maxLat, maxLon)
+
+	if (x1-x0+1)*(y1-y0+1) > maxCellsPerFence {
+		i.large[fence.FenceID] = struct{}{}
+		return
+	}
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			key := cellKey{x: x, y: y}
+			i.cells[key] = append(i.cells[key], fence.FenceID)
+		}
+	}
+	i.fenceBox[fence.FenceID] = [4]int{x0, y0, x1, y1}
+}
+
+func (i *GeofenceIndex) Remove(fenceID uuid.UUID) {
+	delete(i.large, fenceID)
+	box, ok := i.fenceBox[fenceID]
+	if !ok {
+		return
+	}
+	for x := box[0]; x <= box[2]; x++ {
+		for y := box[1]; y <= box[3]; y++ {
+			key := cellKey{x: x, y: y}
+			ids := i.cells[key]
+			for n, id := range ids {
+				if id == fenceID {
+					ids = append(ids[:n], ids[n+1:]...)
+					break
+				}
+			}
+			if len(ids) == 0 {
+				delete(i.cells, key)
+			} else {
+				i.cells[key] = ids
+			}
+		}
+	}
+	delete(i.fenceBox, fenceID)
+}
+
+func (i *GeofenceIndex) Candidates(loc models.Location) []uuid.UUID {
+	x, y := i.cell(loc.Latitude, loc.Longitude)
+	ids := i.cells[cellKey{x: x, y: y}]
+	result := make([]uuid.UUID, 0, len(ids)+len(i.large))
+	result = append(result, ids...)
+	for id := range i.large {
+		result = append(result, id)
+	}
+	return result
+}
+
+func (i *GeofenceIndex) cell(lat, lon float64) (int, int) {
+	return int(math.Floor(lon / i.cellSize)), int(math.Floor(lat / i.cellSize))
+}
+
+func fenceBounds(fence models.Geofence) (minLat, minLon, maxLat, maxLon float64) {
+	if fence.Type == models.GeofenceCircle {
+		dLat := fence.Radius / metersPerDegree
+		dLon := dLat
+		if c := math.Cos(toRadians(fence.Center.Latitude)); c > 1e-9 {
+			dLon = dLat / c
+		}
+		return fence.Center.Latitude - dLat, fence.Center.Longitude - dLon,
+			fence.Center.Latitude + dLat, fence.Center.Longitude + dLon
+	}
+
+	if len(fence.Polygon) == 0 {
+		return 0, 0, 0, 0
+	}
+	minLat, maxLat = fence.Polygon[0].Latitude, fence.Polygon[0].Latitude
+	minLon, maxLon = fence.Polygon[0].Longitude, fence.Polygon[0].Longitude
+	for _, p := range fence.Polygon[1:] {
+		minLat = math.Min(minLat, p.Latitude)
+		maxLat = math.Max(maxLat, p.Latitude)
+		minLon = math.Min(minLon, p.Longitude)
+		maxLon = math.Max(maxLon, p.Longitude)
+	}
+	return minLat, minLon, maxLat, maxLon
+}
+
+// ContainsPoint reports whether loc lies inside the fence. Altitude is ignored.
+func ContainsPoint(fence models.Geofence, loc models.Location) bool {
+	switch fence.Type {
+	case models.GeofenceCircle:
+		return haversineMeters(fence.Center, loc) <= fence.Radius
+	case models.GeofencePolygon:
+		return pointInPolygon(fence.Polygon, loc)
+	default:
+		return false
+	}
+}
+
+// pointInPolygon uses the even-odd ray casting rule on raw lat/lon, which is
+// accurate enough for fences that do not cross the antimeridian.
+func pointInPolygon(polygon []models.Location, loc models.Location) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+	inside := false
+	x, y := loc.Longitude, loc.Latitude
+	j := len(polygon) - 1
+	for i := range polygon {
+		xi, yi := polygon[i].Longitude, polygon[i].Latitude
+		xj, yj := polygon[j].Longitude, polygon[j].Latitude
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
+
+type fenceState struct {
+	enteredAt time.Time
+	dwelled   bool
+}
+
+// GeofenceEngine tracks which fences every device is currently inside and
+// turns consecutive points into enter, exit and dwell events.
+type GeofenceEngine struct {
+	mu     sync.Mutex
+	index  *GeofenceIndex
+	fences map[uuid.UUID]models.Geofence
+	states map[string]map[uuid.UUID]*fenceState
+}
+
+func NewGeofenceEngine(cellSize float64) *GeofenceEngine {
+	return &GeofenceEngine{
+		index:  NewGeofenceIndex(cellSize),
+		fences: make(map[uuid.UUID]models.Geofence),
+		states: make(map[string]map[uuid.UUID]*fenceState),
+	}
+}
+
+func (e *GeofenceEngine) AddFence(fence models.Geofence) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fences[fence.FenceID] = fence
+	e.index.Insert(fence)
+}
+
+func (e *GeofenceEngine) RemoveFence(fenceID uuid.UUID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.fences, fenceID)
+	e.index.Remove(fenceID)
+	for _, states := range e.states {
+		delete(states, fenceID)
+	}
+}
+
+func (e *GeofenceEngine) Process(deviceID string, point models.GPSData) []models.GeofenceEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inside := make(map[uuid.UUID]struct{})
+	for _, id := range e.index.Candidates(point.Location) {
+		fence, ok := e.fences[id]
+		if ok && ContainsPoint(fence, point.Location) {
+			inside[id] = struct{}{}
+		}
+	}
+
+	states, ok := e.states[deviceID]
+	if !ok {
+		if len(inside) == 0 {
+			return nil
+		}
+		states = make(map[uuid.UUID]*fenceState)
+		e.states[deviceID] = states
+	}
+
+	var events []models.GeofenceEvent
+	for id, state := range states {
+		if _, ok := inside[id]; !ok {
+			events = append(events, newGeofenceEvent(id, deviceID, models.GeofenceExit, point))
+			delete(states, id)
+			continue
+		}
+		dwell := e.fences[id].DwellTime
+		if !state.dwelled && dwell > 0 && point.Timestamp.Sub(state.enteredAt) >= dwell {
+			state.dwelled = true
+			events = append(events, newGeofenceEvent(id, deviceID, models.GeofenceDwell, point))
+		}
+	}
+	for id := range inside {
+		if _, ok := states[id]; ok {
+			continue
+		}
+		states[id] = &fenceState{enteredAt: point.Timestamp}
+		events = append(events, newGeofenceEvent(id, deviceID, models.GeofenceEnter, point))
+	}
+	if len(states) == 0 {
+		delete(e.states, deviceID)
+	}
+	return events
+}
+
+func newGeofenceEvent(fenceID uuid.UUID, deviceID string, eventType models.GeofenceEventType, point models.GPSData) models.GeofenceEvent {
+	return models.GeofenceEvent{
+		EventID:   uuid.New(),
+		FenceID:   fenceID,
+		DeviceID:  deviceID,
+		Type:      eventType,
+		Location:  point.Location,
+		Timestamp: point.Timestamp,
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPointInPolygon(t *testing.T) {
+	square := []models.Location{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0, Longitude: 1},
+		{Latitude: 1, Longitude: 1},
+		{Latitude: 1, Longitude: 0},
+	}
+	if !pointInPolygon(square, models.Location{Latitude: 0.5, Longitude: 0.5}) {
+		t.Fatalf("expected center to be inside the square")
+	}
+	if pointInPolygon(square, models.Location{Latitude: 1.5, Longitude: 0.5}) {
+		t.Fatalf("expected point above the square to be outside")
+	}
+}
+
+func TestGeofenceEngineEnterDwellExit(t *testing.T) {
+	engine := NewGeofenceEngine(0.01)
+	fence := models.Geofence{
+		FenceID:   uuid.New(),
+		Type:      models.GeofenceCircle,
+		Center:    models.Location{Latitude: 51.5, Longitude: -0.12},
+		Radius:    200,
+		DwellTime: time.Minute,
+	}
+	engine.AddFence(fence)
+
+	start := time.Now()
+	inside := models.Location{Latitude: 51.5005, Longitude: -0.12}
+	outside := models.Location{Latitude: 51.51, Longitude: -0.12}
+
+	steps := []struct {
+		point models.GPSData
+		want  []models.GeofenceEventType
+	}{
+		{models.GPSData{Location: outside, Timestamp: start}, nil},
+		{models.GPSData{Location: inside, Timestamp: start.Add(time.Second)}, []models.GeofenceEventType{models.GeofenceEnter}},
+		{models.GPSData{Location: inside, Timestamp: start.Add(30 * time.Second)}, nil},
+		{models.GPSData{Location: inside, Timestamp: start.Add(2 * time.Minute)}, []models.GeofenceEventType{models.GeofenceDwell}},
+		{models.GPSData{Location: inside, Timestamp: start.Add(3 * time.Minute)}, nil},
+		{models.GPSData{Location: outside, Timestamp: start.Add(4 * time.Minute)}, []models.GeofenceEventType{models.GeofenceExit}},
+	}
+
+	for i, step := range steps {
+		events := engine.Process("device-1", step.point)
+		if len(events) != len(step.want) {
+			t.Fatalf("step %d: expected %d events, got %d", i, len(step.want), len(events))
+		}
+		for n, event := range events {
+			if event.Type != step.want[n] || event.FenceID != fence.FenceID {
+				t.Fatalf("step %d: unexpected event %+v", i, event)
+			}
+		}
+	}
+}
+
+func TestGeofenceIndexRemove(t *testing.T) {
+	index := NewGeofenceIndex(0.01)
+	fence := models.Geofence{
+		FenceID: uuid.New(),
+		Type:    models.GeofencePolygon,
+		Polygon: []models.Location{
+			{Latitude: 10, Longitude: 10},
+			{Latitude: 10, Longitude: 10.05},
+			{Latitude: 10.05, Longitude: 10.05},
+		},
+	}
+	index.Insert(fence)
+	loc := models.Location{Latitude: 10.01, Longitude: 10.03}
+	if len(index.Candidates(loc)) != 1 {
+		t.Fatalf("expected fence to be a candidate")
+	}
+	index.Remove(fence.FenceID)
+	if len(index.Candidates(loc)) != 0 {
+		t.Fatalf("expected no candidates after removal")
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+type KalmanParams struct {
+	// ProcessNoise is the standard deviation of the unmodelled acceleration in m/s².
+	ProcessNoise float64
+	// MeasurementNoise is the standard deviation of a GPS fix in meters.
+	MeasurementNoise float64
+	// MaxGap resets the filter when two fixes are further apart in time.
+	MaxGap time.Duration
+}
+
+func DefaultKalmanParams() KalmanParams {
+	return KalmanParams{
+		ProcessNoise:     0.5,
+		MeasurementNoise: 10,
+		MaxGap:           time.Minute,
+	}
+}
+
+// mat2 is a row-major 2x2 matrix.
+type mat2 [4]float64
+
+func (a mat2) mul(b mat2) mat2 {
+	return mat2{
+		a[0]*b[0] + a[1]*b[2], a[0]*b[1] + a[1]*b[3],
+		a[2]*b[0] + a[3]*b[2], a[2]*b[1] + a[3]*b[3],
+	}
+}
+
+func (a mat2) add(b mat2) mat2 { return mat2{a[0] + b[0], a[1] + b[1], a[2] + b[2], a[3] + b[3]} }
+func (a mat2) t() mat2         { return mat2{a[0], a[2], a[1], a[3]} }
+
+func (a mat2) inv() mat2 {
+	det := a[0]*a[3] - a[1]*a[2]
+	if det == 0 {
+		return mat2{}
+	}
+	return mat2{a[3] / det, -a[1] / det, -a[2] / det, a[0] / det}
+}
+
+func (a mat2) apply(v [2]float64) [2]float64 {
+	return [2]float64{a[0]*v[0] + a[1]*v[1], a[2]*v[0] + a[3]*v[1]}
+}
+
+// axisFilter is a one-dimensional constant-velocity filter over
+// [position, velocity]. East and north are filtered independently.
+type axisFilter struct {
+	x [2]float64
+	p mat2
+}
+
+func newAxisFilter(pos, measurementVar float64) axisFilter {
+	return axisFilter{
+		x: [2]float64{pos, 0},
+		p: mat2{measurementVar, 0, 0, 100},
+	}
+}
+
+func transition(dt float64) mat2 {
+	return mat2{1, dt, 0, 1}
+}
+
+func processNoise(dt, accelVar float64) mat2 {
+	dt2 := dt * dt
+	return mat2{
+		dt2 * dt2 / 4 * accelVar, dt2 * dt / 2 * accelVar,
+		dt2 * dt / 2 * accelVar, dt2 * accelVar,
+	}
+}
+
+func (f *axisFilter) predict(dt, accelVar float64) {
+	F := transition(dt)
+	f.x = F.apply(f.x)
+	f.p = F.mul(f.p).mul(F.t()).add(processNoise(dt, accelVar))
+}
+
+func (f *axisFilter) update(z, measurementVar float64) {
+	s := f.p[0] + measurementVar
+	k0, k1 := f.p[0]/s, f.p[2]/s
+	residual := z - f.x[0]
+	f.x[0] += k0 * residual
+	f.x[1] += k1 * residual
+	f.p = mat2{
+		(1 - k0) * f.p[0], (1 - k0) * f.p[1],
+		f.p[2] - k1*f.p[0], f.p[3] - k1*f.p[1],
+	}
+}
+
+// localFrame is an equirectangular projection around an origin, good to a
+// few centimetres over the extent of a single trip.
+type localFrame struct {
+	origin models.Location
+	scale  float64
+}
+
+func newLocalFrame(origin models.Location) localFrame {
+	return localFrame{origin: origin, scale: math.Cos(toRadians(origin.Latitude)) * metersPerDegree}
+}
+
+func (f localFrame) toXY(loc models.Location) (float64, float64) {
+	return (loc.Longitude - f.origin.Longitude) * f.scale, (loc.Latitude - f.origin.Latitude) * metersPerDegree
+}
+
+func (f localFrame) toLocation(x, y, altitude float64) models.Location {
+	return models.Location{
+		Latitude:  f.origin.Latitude + y/metersPerDegree,
+		Longitude: f.origin.Longitude + x/f.scale,
+		Altitude:  altitude,
+	}
+}
+
+type trackState struct {
+	frame localFrame
+	east  axisFilter
+	north axisFilter
+	last  time.Time
+}
+
+// KalmanSmoother keeps one constant-velocity filter per device for the live
+// ingest path and can smooth a stored route offline with an RTS pass.
+type KalmanSmoother struct {
+	params KalmanParams
+	mu     sync.Mutex
+	tracks map[string]*trackState
+}
+
+func NewKalmanSmoother(params KalmanParams) *KalmanSmoother {
+	defaults := DefaultKalmanParams()
+	if params.ProcessNoise <= 0 {
+		params.ProcessNoise = defaults.ProcessNoise
+	}
+	if params.MeasurementNoise <= 0 {
+		params.MeasurementNoise = defaults.MeasurementNoise
+	}
+	if params.MaxGap <= 0 {
+		params.MaxGap = defaults.MaxGap
+	}
+	return &KalmanSmoother{
+		params: params,
+		tracks: make(map[string]*trackState),
+	}
+}
+
+func (k *KalmanSmoother) accelVar() float64 {
+	return k.params.ProcessNoise * k.params.ProcessNoise
+}
+
+func (k *KalmanSmoother) measurementVar() float64 {
+	return k.params.MeasurementNoise * k.params.MeasurementNoise
+}
+
+func (k *KalmanSmoother) newTrack(point models.GPSData) *trackState {
+	frame := newLocalFrame(point.Location)
+	return &trackState{
+		frame: frame,
+		east:  newAxisFilter(0, k.measurementVar()),
+		north: newAxisFilter(0, k.measurementVar()),
+		last:  point.Timestamp,
+	}
+}
+
+// FilterPoint folds a live fix into the device's filter and returns the
+// smoothed fix. Out-of-order fixes are passed through untouched.
+func (k *KalmanSmoother) FilterPoint(deviceID string, point models.GPSData) models.GPSData {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	track, ok := k.tracks[deviceID]
+	if !ok || point.Timestamp.Sub(track.last) > k.params.MaxGap {
+		k.tracks[deviceID] = k.newTrack(point)
+		return point
+	}
+	dt := point.Timestamp.Sub(track.last).Seconds()
+	if dt <= 0 {
+		return point
+	}
+
+	x, y := track.frame.toXY(point.Location)
+	track.east.predict(dt, k.accelVar())
+	track.north.predict(dt, k.accelVar())
+	track.east.update(x, k.measurementVar())
+	track.north.update(y, k.measurementVar())
+	track.last = point.Timestamp
+
+	point.Location = track.frame.toLocation(track.east.x[0], track.north.x[0], point.Location.Altitude)
+	return point
+}
+
+// Forget drops the filter state of a device, e.g. when its trip ends.
+func (k *KalmanSmoother) Forget(deviceID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.tracks, deviceID)
+}
+
+type axisStep struct {
+	dt        float64
+	predicted axisFilter
+	filtered  axisFilter
+}
+
+// SmoothRoute runs a forward Kalman pass followed by a Rauch-Tung-Striebel
+// backward pass over the whole route; only the smoothed positions are
+// kept. Gaps longer than MaxGap split the route into independently
+// smoothed pieces.
+func (k *KalmanSmoother) SmoothRoute(route models.Route) models.Route {
+	smoothed := route
+	smoothed.Path = make([]models.GPSData, len(route.Path))
+	copy(smoothed.Path, route.Path)
+
+	start := 0
+	for i := 1; i <= len(route.Path); i++ {
+		if i < len(route.Path) {
+			dt := route.Path[i].Timestamp.Sub(route.Path[i-1].Timestamp)
+			if dt > 0 && dt <= k.params.MaxGap {
+				continue
+			}
+		}
+		k.smoothSegment(smoothed.Path[start:i])
+		start = i
+	}
+	return smoothed
+}
+
+func (k *KalmanSmoother) smoothSegment(points []models.GPSData) {
+	if len(points) < 2 {
+		return
+	}
+	frame := newLocalFrame(points[0].Location)
+	east := make([]axisStep, len(points))
+	north := make([]axisStep, len(points))
+
+	east[0].filtered = newAxisFilter(0, k.measurementVar())
+	north[0].filtered = newAxisFilter(0, k.measurementVar())
+	for i := 1; i < len(points); i++ {
+		dt := points[i].Timestamp.Sub(points[i-1].Timestamp).Seconds()
+		x, y := frame.toXY(points[i].Location)
+		east[i] = k.forwardStep(east[i-1].filtered, dt, x)
+		north[i] = k.forwardStep(north[i-1].filtered, dt, y)
+	}
+
+	eastSmoothed := rtsBackward(east)
+	northSmoothed := rtsBackward(north)
+	for i := range points {
+		points[i].Location = frame.toLocation(eastSmoothed[i], northSmoothed[i], points[i].Location.Altitude)
+	}
+}
+
+func (k *KalmanSmoother) forwardStep(prev axisFilter, dt, z float64) axisStep {
+	step := axisStep{dt: dt, predicted: prev}
+	step.predicted.predict(dt, k.accelVar())
+	step.filtered = step.predicted
+	step.filtered.update(z, k.measurementVar())
+	return step
+}
+
+func rtsBackward(steps []axisStep) []float64 {
+	n := len(steps)
+	positions := make([]float64, n)
+	xs := steps[n-1].filtered.x
+	positions[n-1] = xs[0]
+
+	for i := n - 2; i >= 0; i-- {
+		next := steps[i+1]
+		gain := steps[i].filtered.p.mul(transition(next.dt).t()).mul(next.predicted.p.inv())
+		diff := [2]float64{xs[0] - next.predicted.x[0], xs[1] - next.predicted.x[1]}
+		correction := gain.apply(diff)
+		xs = [2]float64{steps[i].filtered.x[0] + correction[0], steps[i].filtered.x[1] + correction[1]}
+		positions[i] = xs[0]
+	}
+	return positions
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+func jitteredStationaryRoute(n int) models.Route {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Now()
+	center := models.Location{Latitude: 43.238, Longitude: 76.889}
+
+	path := make([]models.GPSData, n)
+	for i := range path {
+		path[i] = models.GPSData{
+			Location: models.Location{
+				Latitude:  center.Latitude + rng.NormFloat64()*10/metersPerDegree,
+				Longitude: center.Longitude + rng.NormFloat64()*10/metersPerDegree,
+			},
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return models.Route{Path: path}
+}
+
+func TestKalmanSmoothRouteReducesJitter(t *testing.T) {
+	route := jitteredStationaryRoute(120)
+	raw := NewAggregator().AggregateRoute(route).TotalDistance
+
+	smoothed := NewKalmanSmoother(DefaultKalmanParams()).SmoothRoute(route)
+	if len(smoothed.Path) != len(route.Path) {
+		t.Fatalf("expected %d points, got %d", len(route.Path), len(smoothed.Path))
+	}
+	got := NewAggregator().AggregateRoute(smoothed).TotalDistance
+	if got > raw/5 {
+		t.Fatalf("expected smoothing to cut phantom distance, raw %.1f smoothed %.1f", raw, got)
+	}
+}
+
+func TestKalmanFilterPointPerDevice(t *testing.T) {
+	route := jitteredStationaryRoute(60)
+	smoother := NewKalmanSmoother(DefaultKalmanParams())
+
+	first := smoother.FilterPoint("a", route.Path[0])
+	if first != route.Path[0] {
+		t.Fatalf("expected the first fix to pass through unchanged")
+	}
+	if got := smoother.FilterPoint("b", route.Path[1]); got != route.Path[1] {
+		t.Fatalf("expected a new device to start its own filter")
+	}
+
+	var raw, filtered float64
+	prev := first
+	for i := 1; i < len(route.Path); i++ {
+		point := smoother.FilterPoint("a", route.Path[i])
+		raw += haversineMeters(route.Path[i-1].Location, route.Path[i].Location)
+		filtered += haversineMeters(prev.Location, point.Location)
+		prev = point
+	}
+	if filtered > raw/2 || math.IsNaN(filtered) {
+		t.Fatalf("expected live filter to cut phantom distance, raw %.1f filtered %.1f", raw, filtered)
+	}
+}
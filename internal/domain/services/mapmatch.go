@@ -0,0 +1,257 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"gps/internal/domain/models"
+)
+
+var ErrNoRoadMatch = errors.New("no road candidates for route")
+
+type MapMatchParams struct {
+	// SearchRadius limits how far from a fix a road may be to be considered.
+	SearchRadius float64
+	// GPSSigma is the standard deviation of the GPS error in meters.
+	GPSSigma float64
+	// Beta scales how strongly detours between fixes are penalised.
+	Beta             float64
+	MaxCandidates    int
+	MaxRouteDistance float64
+}
+
+func DefaultMapMatchParams() MapMatchParams {
+	return MapMatchParams{
+		SearchRadius:     50,
+		GPSSigma:         10,
+		Beta:             5,
+		MaxCandidates:    8,
+		MaxRouteDistance: 5000,
+	}
+}
+
+// MapMatcher snaps GPS traces to a RoadGraph with a hidden Markov model
+// decoded by Viterbi (Newson & Krumm, 2009).
+type MapMatcher struct {
+	graph  *RoadGraph
+	params MapMatchParams
+}
+
+func NewMapMatcher(graph *RoadGraph, params MapMatchParams) *MapMatcher {
+	defaults := DefaultMapMatchParams()
+	if params.SearchRadius <= 0 {
+		params.SearchRadius = defaults.SearchRadius
+	}
+	if params.GPSSigma <= 0 {
+		params.GPSSigma = defaults.GPSSigma
+	}
+	if params.Beta <= 0 {
+		params.Beta = defaults.Beta
+	}
+	if params.MaxCandidates <= 0 {
+		params.MaxCandidates = defaults.MaxCandidates
+	}
+	if params.MaxRouteDistance <= 0 {
+		params.MaxRouteDistance = defaults.MaxRouteDistance
+	}
+	return &MapMatcher{graph: graph, params: params}
+}
+
+type roadCandidate struct {
+	edge     int
+	offset   float64
+	distance float64
+	snapped  models.Location
+}
+
+type viterbiLayer struct {
+	point      models.GPSData
+	candidates []roadCandidate
+	score      []float64
+	back       []int
+}
+
+func (m *MapMatcher) Match(route models.Route) (models.MatchedRoute, error) {
+	result := models.MatchedRoute{RouteID: route.RouteID}
+	paths := make(map[int]shortestPaths)
+
+	var segments [][]roadCandidate
+	var layers []viterbiLayer
+	for _, point := range route.Path {
+		candidates := m.candidates(point.Location)
+		if len(candidates) == 0 {
+			result.SkippedPoints++
+			continue
+		}
+
+		layer := viterbiLayer{
+			point:      point,
+			candidates: candidates,
+			score:      make([]float64, len(candidates)),
+			back:       make([]int, len(candidates)),
+		}
+		if len(layers) == 0 {
+			m.initLayer(&layer)
+			layers = append(layers, layer)
+			continue
+		}
+
+		if !m.stepLayer(layers[len(layers)-1], &layer, paths) {
+			segments = append(segments, backtrack(layers))
+			layers = layers[:0]
+			m.initLayer(&layer)
+		}
+		layers = append(layers, layer)
+	}
+	if len(layers) > 0 {
+		segments = append(segments, backtrack(layers))
+	}
+	if len(segments) == 0 {
+		return result, ErrNoRoadMatch
+	}
+
+	for _, segment := range segments {
+		result.MatchedPoints += len(segment)
+		result.Geometry = append(result.Geometry, segment[0].snapped)
+		for i := 1; i < len(segment); i++ {
+			distance, nodes, _ := m.routeBetween(segment[i-1], segment[i], paths)
+			result.RoadDistance += distance
+			for _, node := range nodes {
+				result.Geometry = append(result.Geometry, m.graph.Nodes[node])
+			}
+			result.Geometry = append(result.Geometry, segment[i].snapped)
+		}
+	}
+	return result, nil
+}
+
+func (m *MapMatcher) initLayer(layer *viterbiLayer) {
+	for j, c := range layer.candidates {
+		layer.score[j] = m.emission(c)
+		layer.back[j] = -1
+	}
+}
+
+// stepLayer fills next from prev and reports whether any candidate is
+// reachable. An unreachable layer breaks the HMM into a new segment.
+func (m *MapMatcher) stepLayer(prev viterbiLayer, next *viterbiLayer, paths map[int]shortestPaths) bool {
+	straight := haversineMeters(prev.point.Location, next.point.Location)
+	reachable := false
+	for j, to := range next.candidates {
+		best := math.Inf(-1)
+		bestIdx := -1
+		for k, from := range prev.candidates {
+			if math.IsInf(prev.score[k], -1) {
+				continue
+			}
+			distance, _, ok := m.routeBetween(from, to, paths)
+			if !ok {
+				continue
+			}
+			score := prev.score[k] - math.Abs(straight-distance)/m.params.Beta
+			if score > best {
+				best = score
+				bestIdx = k
+			}
+		}
+		if bestIdx >= 0 {
+			reachable = true
+			best += m.emission(to)
+		}
+		next.score[j] = best
+		next.back[j] = bestIdx
+	}
+	return reachable
+}
+
+func backtrack(layers []viterbiLayer) []roadCandidate {
+	last := layers[len(layers)-1]
+	idx := 0
+	for j := range last.score {
+		if last.score[j] > last.score[idx] {
+			idx = j
+		}
+	}
+
+	result := make([]roadCandidate, len(layers))
+	for i := len(layers) - 1; i >= 0; i-- {
+		result[i] = layers[i].candidates[idx]
+		idx = layers[i].back[idx]
+	}
+	return result
+}
+
+func (m *MapMatcher) emission(c roadCandidate) float64 {
+	z := c.distance / m.params.GPSSigma
+	return -0.5 * z * z
+}
+
+func (m *MapMatcher) candidates(loc models.Location) []roadCandidate {
+	var result []roadCandidate
+	for _, edgeID := range m.graph.edgesNear(loc, m.params.SearchRadius) {
+		edge := m.graph.Edges[edgeID]
+		offset, distance, snapped := projectOnSegment(loc, m.graph.Nodes[edge.From], m.graph.Nodes[edge.To])
+		if distance > m.params.SearchRadius {
+			continue
+		}
+		result = append(result, roadCandidate{
+			edge:     edgeID,
+			offset:   offset,
+			distance: distance,
+			snapped:  snapped,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].distance < result[j].distance })
+	if len(result) > m.params.MaxCandidates {
+		result = result[:m.params.MaxCandidates]
+	}
+	return result
+}
+
+// routeBetween returns the driven distance between two candidates and the
+// graph nodes passed on the way.
+func (m *MapMatcher) routeBetween(from, to roadCandidate, paths map[int]shortestPaths) (float64, []int, bool) {
+	fromEdge := m.graph.Edges[from.edge]
+	toEdge := m.graph.Edges[to.edge]
+	if from.edge == to.edge && to.offset >= from.offset {
+		return (to.offset - from.offset) * fromEdge.Length, nil, true
+	}
+
+	sp, ok := paths[fromEdge.To]
+	if !ok {
+		sp = m.graph.shortestFrom(fromEdge.To, m.params.MaxRouteDistance)
+		paths[fromEdge.To] = sp
+	}
+	between, ok := sp.dist[toEdge.From]
+	if !ok {
+		return 0, nil, false
+	}
+	distance := (1-from.offset)*fromEdge.Length + between + to.offset*toEdge.Length
+	return distance, sp.nodesTo(m.graph, toEdge.From), true
+}
+
+// projectOnSegment projects p onto the segment a-b in a local equirectangular
+// frame centred on p and returns the fraction along the segment, the
+// distance to it and the projected location.
+func projectOnSegment(p, a, b models.Location) (float64, float64, models.Location) {
+	scale := math.Cos(toRadians(p.Latitude)) * metersPerDegree
+	ax := (a.Longitude - p.Longitude) * scale
+	ay := (a.Latitude - p.Latitude) * metersPerDegree
+	bx := (b.Longitude - p.Longitude) * scale
+	by := (b.Latitude - p.Latitude) * metersPerDegree
+
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+		t = -(ax*dx + ay*dy) / lengthSq
+		t = math.Max(0, math.Min(1, t))
+	}
+	sx, sy := ax+t*dx, ay+t*dy
+
+	snapped := models.Location{
+		Latitude:  a.Latitude + t*(b.Latitude-a.Latitude),
+		Longitude: a.Longitude + t*(b.Longitude-a.Longitude),
+	}
+	return t, math.Hypot(sx, sy), snapped
+}
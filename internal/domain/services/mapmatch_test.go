@@ -0,0 +1,69 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+func TestMapMatcherSnapsZigZagToRoad(t *testing.T) {
+	graph := NewRoadGraph()
+	// An east-west road with a parallel road ~220 m to the north.
+	graph.AddRoad([]models.Location{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0, Longitude: 0.005},
+		{Latitude: 0, Longitude: 0.01},
+	}, false)
+	graph.AddRoad([]models.Location{
+		{Latitude: 0.002, Longitude: 0},
+		{Latitude: 0.002, Longitude: 0.01},
+	}, false)
+
+	start := time.Now()
+	var path []models.GPSData
+	for i := 0; i <= 10; i++ {
+		offset := 0.0001
+		if i%2 == 1 {
+			offset = -0.0001
+		}
+		path = append(path, models.GPSData{
+			Location:  models.Location{Latitude: offset, Longitude: float64(i) * 0.001},
+			Timestamp: start.Add(time.Duration(i) * 5 * time.Second),
+		})
+	}
+	route := models.Route{Path: path}
+
+	matched, err := NewMapMatcher(graph, DefaultMapMatchParams()).Match(route)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matched.MatchedPoints != len(path) {
+		t.Fatalf("expected all points matched, got %d", matched.MatchedPoints)
+	}
+
+	roadLength := haversineMeters(models.Location{}, models.Location{Longitude: 0.01})
+	if math.Abs(matched.RoadDistance-roadLength) > 1 {
+		t.Fatalf("expected road distance ~%.1f, got %.1f", roadLength, matched.RoadDistance)
+	}
+	raw := NewAggregator().AggregateRoute(route).TotalDistance
+	if matched.RoadDistance >= raw {
+		t.Fatalf("expected matched distance %.1f to be shorter than raw %.1f", matched.RoadDistance, raw)
+	}
+	for _, loc := range matched.Geometry {
+		if loc.Latitude != 0 {
+			t.Fatalf("expected geometry on the southern road, got %+v", loc)
+		}
+	}
+}
+
+func TestMapMatcherNoCandidates(t *testing.T) {
+	graph := NewRoadGraph()
+	graph.AddRoad([]models.Location{{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 0.01}}, false)
+
+	route := models.Route{Path: []models.GPSData{{Location: models.Location{Latitude: 1, Longitude: 1}}}}
+	if _, err := NewMapMatcher(graph, DefaultMapMatchParams()).Match(route); err != ErrNoRoadMatch {
+		t.Fatalf("expected ErrNoRoadMatch, got %v", err)
+	}
+}
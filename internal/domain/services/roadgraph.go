@@ -0,0 +1,190 @@
+package services
+
+import (
+	"container/heap"
+	"math"
+
+	"gps/internal/domain/models"
+)
+
+const (
+	defaultRoadCellDegrees = 0.005
+	nodeKeyPrecision       = 1e7
+)
+
+type RoadEdge struct {
+	From   int
+	To     int
+	Length float64
+}
+
+// RoadGraph is a directed road network. Two-way roads are stored as a pair of
+// opposite edges. Edges are bucketed in a lat/lon grid for candidate lookup.
+type RoadGraph struct {
+	Nodes     []models.Location
+	Edges     []RoadEdge
+	adjacency [][]int
+	nodeKeys  map[[2]int64]int
+	cells     map[cellKey][]int
+	cellSize  float64
+}
+
+func NewRoadGraph() *RoadGraph {
+	return &RoadGraph{
+		nodeKeys: make(map[[2]int64]int),
+		cells:    make(map[cellKey][]int),
+		cellSize: defaultRoadCellDegrees,
+	}
+}
+
+// AddRoad adds a polyline to the graph. Vertices with identical coordinates
+// are merged, so roads sharing a vertex become connected.
+func (g *RoadGraph) AddRoad(line []models.Location, oneway bool) {
+	for i := 1; i < len(line); i++ {
+		from := g.nodeAt(line[i-1])
+		to := g.nodeAt(line[i])
+		if from == to {
+			continue
+		}
+		g.addEdge(from, to)
+		if !oneway {
+			g.addEdge(to, from)
+		}
+	}
+}
+
+func (g *RoadGraph) nodeAt(loc models.Location) int {
+	key := [2]int64{
+		int64(math.Round(loc.Latitude * nodeKeyPrecision)),
+		int64(math.Round(loc.Longitude * nodeKeyPrecision)),
+	}
+	if id, ok := g.nodeKeys[key]; ok {
+		return id
+	}
+	id := len(g.Nodes)
+	g.Nodes = append(g.Nodes, models.Location{Latitude: loc.Latitude, Longitude: loc.Longitude})
+	g.adjacency = append(g.adjacency, nil)
+	g.nodeKeys[key] = id
+	return id
+}
+
+func (g *RoadGraph) addEdge(from, to int) {
+	id := len(g.Edges)
+	g.Edges = append(g.Edges, RoadEdge{
+		From:   from,
+		To:     to,
+		Length: haversineMeters(g.Nodes[from], g.Nodes[to]),
+	})
+	g.adjacency[from] = append(g.adjacency[from], id)
+
+	a, b := g.Nodes[from], g.Nodes[to]
+	x0, y0 := g.cell(math.Min(a.Latitude, b.Latitude), math.Min(a.Longitude, b.Longitude))
+	x1, y1 := g.cell(math.Max(a.Latitude, b.Latitude), math.Max(a.Longitude, b.Longitude))
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			key := cellKey{x: x, y: y}
+			g.cells[key] = append(g.cells[key], id)
+		}
+	}
+}
+
+func (g *RoadGraph) cell(lat, lon float64) (int, int) {
+	return int(math.Floor(lon / g.cellSize)), int(math.Floor(lat / g.cellSize))
+}
+
+// edgesNear returns the ids of edges whose grid cells overlap a square of
+// radius meters around loc.
+func (g *RoadGraph) edgesNear(loc models.Location, radius float64) []int {
+	dLat := radius / metersPerDegree
+	dLon := dLat
+	if c := math.Cos(toRadians(loc.Latitude)); c > 1e-9 {
+		dLon = dLat / c
+	}
+	x0, y0 := g.cell(loc.Latitude-dLat, loc.Longitude-dLon)
+	x1, y1 := g.cell(loc.Latitude+dLat, loc.Longitude+dLon)
+
+	seen := make(map[int]struct{})
+	var result []int
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			for _, id := range g.cells[cellKey{x: x, y: y}] {
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				seen[id] = struct{}{}
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+type shortestPaths struct {
+	dist map[int]float64
+	prev map[int]int
+}
+
+// shortestFrom runs Dijkstra from src and stops expanding past maxDist.
+// prev maps a node to the edge used to reach it.
+func (g *RoadGraph) shortestFrom(src int, maxDist float64) shortestPaths {
+	result := shortestPaths{
+		dist: map[int]float64{src: 0},
+		prev: make(map[int]int),
+	}
+	queue := &nodeQueue{{node: src}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(nodeDistance)
+		if item.dist > result.dist[item.node] {
+			continue
+		}
+		for _, edgeID := range g.adjacency[item.node] {
+			edge := g.Edges[edgeID]
+			next := item.dist + edge.Length
+			if next > maxDist {
+				continue
+			}
+			if current, ok := result.dist[edge.To]; ok && current <= next {
+				continue
+			}
+			result.dist[edge.To] = next
+			result.prev[edge.To] = edgeID
+			heap.Push(queue, nodeDistance{node: edge.To, dist: next})
+		}
+	}
+	return result
+}
+
+// nodesTo walks prev back from dst and returns the node sequence src..dst.
+func (p shortestPaths) nodesTo(g *RoadGraph, dst int) []int {
+	var nodes []int
+	for node := dst; ; {
+		nodes = append(nodes, node)
+		edgeID, ok := p.prev[node]
+		if !ok {
+			break
+		}
+		node = g.Edges[edgeID].From
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+type nodeDistance struct {
+	node int
+	dist float64
+}
+
+type nodeQueue []nodeDistance
+
+func (q nodeQueue) Len() int           { return len(q) }
+func (q nodeQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q nodeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x any)        { *q = append(*q, x.(nodeDistance)) }
+func (q *nodeQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+type rollupSlot struct {
+	key   models.RollupKey
+	start int64
+}
+
+// RollupBuilder collects points into fixed-size buckets per key. The
+// segment between two consecutive fixes of a device is attributed to the
+// bucket of the later fix; segments longer than maxGap are not counted.
+type RollupBuilder struct {
+	mu       sync.Mutex
+	distance DistanceStrategy
+	bucket   time.Duration
+	maxGap   time.Duration
+	last     map[string]models.GPSData
+	open     map[rollupSlot]*models.Rollup
+}
+
+func NewRollupBuilder(distance DistanceStrategy, bucket, maxGap time.Duration) *RollupBuilder {
+	if distance == nil {
+		distance = WithAltitude(Haversine)
+	}
+	if bucket <= 0 {
+		bucket = time.Minute
+	}
+	if maxGap <= 0 {
+		maxGap = 5 * time.Minute
+	}
+	return &RollupBuilder{
+		distance: distance,
+		bucket:   bucket,
+		maxGap:   maxGap,
+		last:     make(map[string]models.GPSData),
+		open:     make(map[rollupSlot]*models.Rollup),
+	}
+}
+
+func (b *RollupBuilder) Add(key models.RollupKey, point models.GPSData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start := point.Timestamp.Truncate(b.bucket)
+	slot := rollupSlot{key: key, start: start.UnixNano()}
+	rollup, ok := b.open[slot]
+	if !ok {
+		rollup = &models.Rollup{BucketStart: start, Meta: key}
+		b.open[slot] = rollup
+	}
+	rollup.Points++
+
+	prev, ok := b.last[key.DeviceID]
+	if ok && point.Timestamp.Before(prev.Timestamp) {
+		return
+	}
+	b.last[key.DeviceID] = point
+	if !ok {
+		return
+	}
+	dt := point.Timestamp.Sub(prev.Timestamp)
+	if dt <= 0 || dt > b.maxGap {
+		return
+	}
+	segment := b.distance.Distance(prev.Location, point.Location)
+	rollup.Distance += segment
+	rollup.MovingSeconds += dt.Seconds()
+	rollup.MaxSpeed = math.Max(rollup.MaxSpeed, segment/dt.Seconds())
+}
+
+// Requeue puts back rollups returned by Flush that could not be stored,
+// merging them with buckets for the same slot that have opened since.
+func (b *RollupBuilder) Requeue(rollups []models.Rollup) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range rollups {
+		slot := rollupSlot{key: r.Meta, start: r.BucketStart.UnixNano()}
+		open, ok := b.open[slot]
+		if !ok {
+			r := r
+			b.open[slot] = &r
+			continue
+		}
+		open.Points += r.Points
+		open.Distance += r.Distance
+		open.MovingSeconds += r.MovingSeconds
+		open.MaxSpeed = math.Max(open.MaxSpeed, r.MaxSpeed)
+	}
+}
+
+// Flush removes and returns every bucket that ended at or before until,
+// ordered by bucket start.
+func (b *RollupBuilder) Flush(until time.Time) []models.Rollup {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result []models.Rollup
+	for slot, rollup := range b.open {
+		if rollup.BucketStart.Add(b.bucket).After(until) {
+			continue
+		}
+		result = append(result, *rollup)
+		delete(b.open, slot)
+	}
+	for device, point := range b.last {
+		if until.Sub(point.Timestamp) > b.maxGap {
+			delete(b.last, device)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].BucketStart.Before(result[j].BucketStart) })
+	return result
+}
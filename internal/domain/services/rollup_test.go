@@ -0,0 +1,79 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+func TestRollupBuilderBucketsByMinute(t *testing.T) {
+	builder := NewRollupBuilder(Haversine, time.Minute, 5*time.Minute)
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	key := models.RollupKey{DeviceID: "truck-1"}
+
+	for i := 0; i < 12; i++ {
+		builder.Add(key, models.GPSData{
+			Location:  models.Location{Latitude: 0, Longitude: float64(i) * 0.001},
+			Timestamp: start.Add(time.Duration(i) * 10 * time.Second),
+		})
+	}
+
+	if got := builder.Flush(start.Add(59 * time.Second)); len(got) != 0 {
+		t.Fatalf("expected no completed buckets yet, got %d", len(got))
+	}
+	rollups := builder.Flush(start.Add(2 * time.Minute))
+	if len(rollups) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(rollups))
+	}
+	if rollups[0].Points != 6 || rollups[1].Points != 6 {
+		t.Fatalf("unexpected point counts: %d, %d", rollups[0].Points, rollups[1].Points)
+	}
+
+	segment := Haversine.Distance(models.Location{}, models.Location{Longitude: 0.001})
+	if math.Abs(rollups[0].Distance-5*segment) > 1e-6 || math.Abs(rollups[1].Distance-6*segment) > 1e-6 {
+		t.Fatalf("unexpected distances: %.3f, %.3f", rollups[0].Distance, rollups[1].Distance)
+	}
+}
+
+func TestRollupBuilderSkipsLongGaps(t *testing.T) {
+	builder := NewRollupBuilder(Haversine, time.Minute, time.Minute)
+	start := time.Now().Truncate(time.Minute)
+	key := models.RollupKey{DeviceID: "truck-1"}
+
+	builder.Add(key, models.GPSData{Timestamp: start})
+	builder.Add(key, models.GPSData{Location: models.Location{Longitude: 1}, Timestamp: start.Add(10 * time.Minute)})
+
+	for _, rollup := range builder.Flush(start.Add(time.Hour)) {
+		if rollup.Distance != 0 {
+			t.Fatalf("expected the gap not to be counted, got %.1f", rollup.Distance)
+		}
+	}
+}
+
+func TestRollupBuilderRequeueMergesWithReopenedBucket(t *testing.T) {
+	builder := NewRollupBuilder(Haversine, time.Minute, 5*time.Minute)
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	key := models.RollupKey{DeviceID: "truck-1"}
+
+	builder.Add(key, models.GPSData{Timestamp: start})
+	builder.Add(key, models.GPSData{Location: models.Location{Longitude: 0.001}, Timestamp: start.Add(10 * time.Second)})
+	failed := builder.Flush(start.Add(time.Minute))
+	if len(failed) != 1 {
+		t.Fatalf("expected 1 bucket, got %d", len(failed))
+	}
+
+	// A late point reopens the same minute before the failed write is retried.
+	builder.Add(key, models.GPSData{Location: models.Location{Longitude: 0.002}, Timestamp: start.Add(20 * time.Second)})
+	builder.Requeue(failed)
+
+	rollups := builder.Flush(start.Add(time.Minute))
+	if len(rollups) != 1 {
+		t.Fatalf("expected the requeued bucket to merge, got %d buckets", len(rollups))
+	}
+	segment := Haversine.Distance(models.Location{}, models.Location{Longitude: 0.001})
+	if rollups[0].Points != 3 || math.Abs(rollups[0].Distance-2*segment) > 1e-6 {
+		t.Fatalf("unexpected merged bucket %+v", rollups[0])
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"gps/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type TripParams struct {
+	// MinMovingSpeed in m/s above which a device counts as moving.
+	MinMovingSpeed float64
+	// IdleTimeout closes a trip after the device has not moved for this long.
+	IdleTimeout time.Duration
+	// MaxGap closes a trip when no fix arrived for this long.
+	MaxGap time.Duration
+}
+
+func DefaultTripParams() TripParams {
+	return TripParams{
+		MinMovingSpeed: 1.5,
+		IdleTimeout:    5 * time.Minute,
+		MaxGap:         10 * time.Minute,
+	}
+}
+
+type deviceTrip struct {
+	routeID    uuid.UUID
+	lastSeen   models.GPSData
+	lastMoving time.Time
+}
+
+// TripDetector turns the point stream of each device into trips. A trip
+// opens on the first movement, collects every following fix and closes
+// after IdleTimeout without movement or after a MaxGap without data.
+type TripDetector struct {
+	params   TripParams
+	distance DistanceStrategy
+	mu       sync.Mutex
+	last     map[string]models.GPSData
+	trips    map[string]*deviceTrip
+}
+
+func NewTripDetector(params TripParams, distance DistanceStrategy) *TripDetector {
+	defaults := DefaultTripParams()
+	if params.MinMovingSpeed <= 0 {
+		params.MinMovingSpeed = defaults.MinMovingSpeed
+	}
+	if params.IdleTimeout <= 0 {
+		params.IdleTimeout = defaults.IdleTimeout
+	}
+	if params.MaxGap <= 0 {
+		params.MaxGap = defaults.MaxGap
+	}
+	if distance == nil {
+		distance = Haversine
+	}
+	return &TripDetector{
+		params:   params,
+		distance: distance,
+		last:     make(map[string]models.GPSData),
+		trips:    make(map[string]*deviceTrip),
+	}
+}
+
+func (d *TripDetector) Process(deviceID string, point models.GPSData) []models.TripEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev, seen := d.last[deviceID]
+	if seen && !point.Timestamp.After(prev.Timestamp) {
+		return nil
+	}
+	d.last[deviceID] = point
+
+	var events []models.TripEvent
+	trip, open := d.trips[deviceID]
+	if open && point.Timestamp.Sub(trip.lastSeen.Timestamp) > d.params.MaxGap {
+		events = append(events, d.finish(deviceID, trip, trip.lastSeen.Timestamp))
+		open = false
+	}
+
+	moving := false
+	if seen {
+		dt := point.Timestamp.Sub(prev.Timestamp)
+		if dt <= d.params.MaxGap {
+			moving = d.distance.Distance(prev.Location, point.Location)/dt.Seconds() >= d.params.MinMovingSpeed
+		}
+	}
+
+	if !open {
+		if !moving {
+			return events
+		}
+		trip = &deviceTrip{routeID: uuid.New(), lastSeen: prev, lastMoving: point.Timestamp}
+		d.trips[deviceID] = trip
+		// The fix the movement started from belongs to the trip as well.
+		events = append(events,
+			models.TripEvent{Type: models.TripStarted, DeviceID: deviceID, RouteID: trip.routeID, Point: prev},
+			models.TripEvent{Type: models.TripPoint, DeviceID: deviceID, RouteID: trip.routeID, Point: point},
+		)
+		trip.lastSeen = point
+		return events
+	}
+
+	trip.lastSeen = point
+	events = append(events, models.TripEvent{Type: models.TripPoint, DeviceID: deviceID, RouteID: trip.routeID, Point: point})
+	if moving {
+		trip.lastMoving = point.Timestamp
+	} else if point.Timestamp.Sub(trip.lastMoving) >= d.params.IdleTimeout {
+		events = append(events, d.finish(deviceID, trip, trip.lastMoving))
+	}
+	return events
+}
+
+// Expire closes the trips of devices that have been silent for longer than
+// MaxGap at now.
+func (d *TripDetector) Expire(now time.Time) []models.TripEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []models.TripEvent
+	for deviceID, trip := range d.trips {
+		if now.Sub(trip.lastSeen.Timestamp) > d.params.MaxGap {
+			events = append(events, d.finish(deviceID, trip, trip.lastSeen.Timestamp))
+		}
+	}
+	for deviceID, point := range d.last {
+		if _, open := d.trips[deviceID]; !open && now.Sub(point.Timestamp) > d.params.MaxGap {
+			delete(d.last, deviceID)
+		}
+	}
+	return events
+}
+
+// CurrentRoute returns the route of the trip a device is on, if any.
+func (d *TripDetector) CurrentRoute(deviceID string) (uuid.UUID, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	trip, ok := d.trips[deviceID]
+	if !ok {
+		return uuid.Nil, false
+	}
+	return trip.routeID, true
+}
+
+func (d *TripDetector) finish(deviceID string, trip *deviceTrip, end time.Time) models.TripEvent {
+	delete(d.trips, deviceID)
+	return models.TripEvent{
+		Type:     models.TripFinished,
+		DeviceID: deviceID,
+		RouteID:  trip.routeID,
+		Point:    trip.lastSeen,
+		EndTime:  end,
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"gps/internal/domain/models"
+)
+
+func tripPoint(start time.Time, seconds int, lon float64) models.GPSData {
+	return models.GPSData{
+		Location:  models.Location{Longitude: lon},
+		Timestamp: start.Add(time.Duration(seconds) * time.Second),
+	}
+}
+
+func eventTypes(events []models.TripEvent) []models.TripEventType {
+	var types []models.TripEventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestTripDetectorOpensAndClosesOnIdle(t *testing.T) {
+	detector := NewTripDetector(TripParams{MinMovingSpeed: 1, IdleTimeout: time.Minute, MaxGap: 5 * time.Minute}, Haversine)
+	start := time.Now()
+
+	if events := detector.Process("car", tripPoint(start, 0, 0)); len(events) != 0 {
+		t.Fatalf("expected no events for a standing device, got %v", eventTypes(events))
+	}
+	events := detector.Process("car", tripPoint(start, 10, 0.001))
+	if len(events) != 2 || events[0].Type != models.TripStarted || events[1].Type != models.TripPoint {
+		t.Fatalf("expected start and point, got %v", eventTypes(events))
+	}
+	routeID := events[0].RouteID
+	if current, ok := detector.CurrentRoute("car"); !ok || current != routeID {
+		t.Fatalf("expected car to be on route %s", routeID)
+	}
+
+	detector.Process("car", tripPoint(start, 20, 0.002))
+	detector.Process("car", tripPoint(start, 50, 0.002))
+	events = detector.Process("car", tripPoint(start, 90, 0.002))
+	if len(events) != 2 || events[1].Type != models.TripFinished {
+		t.Fatalf("expected point and finish, got %v", eventTypes(events))
+	}
+	if events[1].RouteID != routeID || !events[1].EndTime.Equal(start.Add(20*time.Second)) {
+		t.Fatalf("unexpected finish event %+v", events[1])
+	}
+	if _, ok := detector.CurrentRoute("car"); ok {
+		t.Fatalf("expected no open trip after finish")
+	}
+}
+
+func TestTripDetectorClosesOnDataGap(t *testing.T) {
+	detector := NewTripDetector(TripParams{MinMovingSpeed: 1, IdleTimeout: time.Hour, MaxGap: time.Minute}, Haversine)
+	start := time.Now()
+
+	detector.Process("car", tripPoint(start, 0, 0))
+	detector.Process("car", tripPoint(start, 10, 0.001))
+
+	if events := detector.Expire(start.Add(30 * time.Second)); len(events) != 0 {
+		t.Fatalf("expected trip to stay open, got %v", eventTypes(events))
+	}
+	events := detector.Expire(start.Add(2 * time.Minute))
+	if len(events) != 1 || events[0].Type != models.TripFinished {
+		t.Fatalf("expected finish after gap, got %v", eventTypes(events))
+	}
+	if !events[0].EndTime.Equal(start.Add(10 * time.Second)) {
+		t.Fatalf("expected end time at the last fix, got %s", events[0].EndTime)
+	}
+}
@@ -3,11 +3,19 @@ package exchanger
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 )
 
+var ErrUnauthenticated = errors.New("device not authenticated")
+
+// AuthFunc admits a device before any of its lines are parsed. deviceID is
+// the exchanger name and credential is the first line the device sends.
+type AuthFunc func(ctx context.Context, deviceID, credential string) error
+
 type LiveExchanger[T any] struct {
 	Name          string
 	Host          string
@@ -16,6 +24,7 @@ type LiveExchanger[T any] struct {
 	wg            *sync.WaitGroup
 	cancel        context.CancelFunc
 	parse         func(raw string) (T, error)
+	authenticate  AuthFunc
 }
 
 func NewLiveExchanger[T any](name, host, port string, parse func(raw string) (T, error)) (*LiveExchanger[T], error) {
@@ -73,6 +82,9 @@ func (l *LiveExchanger[T]) Stop() error {
 func (l *LiveExchanger[T]) handle(ctx context.Context, conn net.Conn, out chan<- Task[T]) error {
 	defer conn.Close()
 	scanner := bufio.NewScanner(conn)
+	if err := l.handshake(ctx, scanner); err != nil {
+		return err
+	}
 
 	for scanner.Scan() {
 		select {
@@ -98,6 +110,24 @@ func (l *LiveExchanger[T]) handle(ctx context.Context, conn net.Conn, out chan<-
 	return fmt.Errorf("connection to exchanger %s closed", l.Name)
 }
 
+// handshake reads the credential line when an authenticator is set. The
+// connection is dropped before any point is parsed if it is rejected.
+func (l *LiveExchanger[T]) handshake(ctx context.Context, scanner *bufio.Scanner) error {
+	if l.authenticate == nil {
+		return nil
+	}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("exchanger %s: %w: connection closed before handshake", l.Name, ErrUnauthenticated)
+	}
+	if err := l.authenticate(ctx, l.Name, strings.TrimSpace(scanner.Text())); err != nil {
+		return fmt.Errorf("exchanger %s: %w: %w", l.Name, ErrUnauthenticated, err)
+	}
+	return nil
+}
+
 func (l *LiveExchanger[T]) sendResult(results chan<- Result, err error) {
 	results <- Result{Name: l.Name, Host: l.Host, Port: l.Port, ReceivedTasks: l.receivedTasks, Err: err}
 }
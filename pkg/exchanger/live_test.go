@@ -0,0 +1,83 @@
+package exchanger
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveLines accepts one connection and writes lines to it.
+func serveLines(t *testing.T, lines ...string) (string, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	return host, port
+}
+
+func TestLiveExchangerHandshake(t *testing.T) {
+	authenticate := func(_ context.Context, deviceID, credential string) error {
+		if deviceID == "359339" && credential == "key" {
+			return nil
+		}
+		return errors.New("rejected")
+	}
+	parse := func(raw string) (string, error) { return raw, nil }
+
+	tests := []struct {
+		name    string
+		lines   []string
+		wantOut []string
+		wantErr error
+	}{
+		{name: "accepted", lines: []string{"key", "p1", "p2"}, wantOut: []string{"p1", "p2"}},
+		{name: "wrong key", lines: []string{"nope", "p1"}, wantErr: ErrUnauthenticated},
+		{name: "no handshake", wantErr: ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port := serveLines(t, tt.lines...)
+			ex, err := NewLiveExchanger("359339", host, port, parse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ex.authenticate = authenticate
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			out := make(chan Task[string], 4)
+			results := make(chan Result, 1)
+			ex.Stream(ctx, out, results)
+			close(out)
+
+			var got []string
+			for task := range out {
+				got = append(got, task.Data)
+			}
+			if len(got) != len(tt.wantOut) {
+				t.Fatalf("out = %v, want %v", got, tt.wantOut)
+			}
+			res := <-results
+			if tt.wantErr != nil && !errors.Is(res.Err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", res.Err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package exchanger
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
@@ -25,15 +26,19 @@ func WrapTask[T any](from string, data T) Task[T] {
 	}
 }
 
+var ErrPoolStopped = errors.New("pool stopped")
+
 type Pool[T any] struct {
 	MaxCount   int
 	Exchangers map[string]Exchanger[T]
 	numClients int
 
-	wg     *sync.WaitGroup
-	out    chan Task[T]
-	result chan Result
-	mu     sync.Mutex
+	wg           *sync.WaitGroup
+	out          chan Task[T]
+	result       chan Result
+	mu           sync.Mutex
+	authenticate AuthFunc
+	stopped      bool
 }
 
 func NewPool[T any](maxCount int) *Pool[T] {
@@ -48,6 +53,14 @@ func NewPool[T any](maxCount int) *Pool[T] {
 	return pool
 }
 
+// SetAuthenticator makes every live exchanger added afterwards present a
+// credential before streaming. Test exchangers are simulated and skip it.
+func (p *Pool[T]) SetAuthenticator(authenticate AuthFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.authenticate = authenticate
+}
+
 func (p *Pool[T]) GetConnectedExchangers() map[string]bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -66,7 +79,6 @@ func (p *Pool[T]) Add(ctx context.Context, name, host, port string, parse func(r
 	if n >= p.MaxCount {
 		return fmt.Errorf("max exchangers limit reached: %d", p.MaxCount)
 	}
-	p.numClients = n
 
 	if _, exists := p.Exchangers[name]; exists {
 		return fmt.Errorf("exchanger with name %s already exists", name)
@@ -76,6 +88,13 @@ func (p *Pool[T]) Add(ctx context.Context, name, host, port string, parse func(r
 	if err != nil {
 		return err
 	}
+	if worker == nil {
+		return fmt.Errorf("exchanger %s needs a host and port", name)
+	}
+	worker.authenticate = p.authenticate
+	// Only claim the slot once nothing can fail, so rejected adds do not
+	// shrink the pool.
+	p.numClients = n
 	p.Exchangers[name] = worker
 
 	p.wg.Add(1)
@@ -137,8 +156,30 @@ func (p *Pool[T]) Remove(name string) {
 	}
 }
 
+// Submit pushes data to Out as if exchanger from had received it, so
+// sources outside the pool, such as HTTP uploads, share its pipeline. It
+// blocks until the task is taken or ctx is done.
+func (p *Pool[T]) Submit(ctx context.Context, from string, data T) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrPoolStopped
+	}
+	p.wg.Add(1)
+	p.mu.Unlock()
+	defer p.wg.Done()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.out <- WrapTask(from, data):
+		return nil
+	}
+}
+
 func (p *Pool[T]) StopPool() {
 	p.mu.Lock()
+	p.stopped = true
 	fmt.Println(len(p.Exchangers))
 	for n, exchanger := range p.Exchangers {
 		slog.Warn("stopping exchanger...", "name", n)
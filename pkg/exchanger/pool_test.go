@@ -54,3 +54,44 @@ func TestPool(t *testing.T) {
 
 	time.Sleep(10 * time.Second)
 }
+
+func TestPoolSubmit(t *testing.T) {
+	pool := NewPool[string](5)
+	done := make(chan Task[string], 1)
+	go func() {
+		for task := range pool.Out() {
+			done <- task
+		}
+	}()
+	go func() {
+		for range pool.Results() {
+		}
+	}()
+
+	if err := pool.Submit(context.Background(), "http", "point"); err != nil {
+		t.Fatal(err)
+	}
+	if task := <-done; task.Exchanger != "http" || task.Data != "point" {
+		t.Fatalf("task = %+v", task)
+	}
+	pool.StopPool()
+	if err := pool.Submit(context.Background(), "http", "late"); err != ErrPoolStopped {
+		t.Fatalf("Submit after stop err = %v, want ErrPoolStopped", err)
+	}
+}
+
+func TestPoolRejectedAddKeepsSlot(t *testing.T) {
+	pool := NewPool[string](2)
+	parse := func(raw string) (string, error) { return raw, nil }
+
+	for range 3 {
+		if err := pool.Add(context.Background(), "no-host", "", "", parse); err == nil {
+			t.Fatal("expected an exchanger without host to be rejected")
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.numClients != 0 {
+		t.Fatalf("numClients = %d after rejected adds, want 0", pool.numClients)
+	}
+}
@@ -11,13 +11,29 @@ import (
 
 type ClientList map[*Client]bool
 
+// outboundBuffer lets command replies queue behind a burst of updates
+// instead of being dropped.
+const outboundBuffer = 16
+
 type Client struct {
 	conn      *websocket.Conn
 	manager   *Manager
 	inbound   chan []byte
 	outbound  chan []byte
+	done      chan struct{}
 	closeOnce sync.Once
 	id        uuid.UUID
+	expiresAt time.Time
+	principal any
+	// topics is guarded by manager.mu.
+	topics map[uuid.UUID]bool
+
+	mu       sync.Mutex
+	closed   bool
+	interval time.Duration
+	pending  map[uuid.UUID][]byte
+	rate     chan struct{}
+	lastAck  string
 }
 
 var (
@@ -31,13 +47,84 @@ func NewClient(id uuid.UUID, conn *websocket.Conn, manager *Manager) *Client {
 		conn:     conn,
 		manager:  manager,
 		inbound:  make(chan []byte),
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, outboundBuffer),
+		done:     make(chan struct{}),
+		topics:   make(map[uuid.UUID]bool),
+		pending:  make(map[uuid.UUID][]byte),
+		rate:     make(chan struct{}, 1),
+	}
+}
+
+// ID is the topic the connection was opened for.
+func (c *Client) ID() uuid.UUID {
+	return c.id
+}
+
+// Principal is whatever authorized the connection, see WithPrincipal.
+func (c *Client) Principal() any {
+	return c.principal
+}
+
+// LastAck is the id of the last update frame the client acknowledged.
+func (c *Client) LastAck() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastAck
+}
+
+func (c *Client) acknowledge(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAck = id
+}
+
+// Send queues a frame for the client without waiting. It reports false if
+// the client is closed or its queue is full.
+func (c *Client) Send(frame []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.outbound <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetInterval limits topic updates to one per topic every d; only the
+// latest update of each topic is kept in between. Zero sends every update
+// as it arrives.
+func (c *Client) SetInterval(d time.Duration) {
+	c.mu.Lock()
+	c.interval = d
+	c.mu.Unlock()
+	select {
+	case c.rate <- struct{}{}:
+	default:
+	}
+}
+
+// update delivers a topic update, holding it back when a rate is set.
+func (c *Client) update(topic uuid.UUID, frame []byte) {
+	c.mu.Lock()
+	if c.interval > 0 && !c.closed {
+		c.pending[topic] = frame
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	if !c.Send(frame) {
+		slog.Warn("Client outbound channel full", "client_id", c.id, "topic", topic)
 	}
 }
 
 func (c *Client) readMessages() {
 	defer func() {
 		c.close()
+		close(c.inbound)
 	}()
 
 	c.conn.SetReadLimit(512)
@@ -56,19 +143,41 @@ func (c *Client) readMessages() {
 			slog.Info("Client disconnected", "client_id", c.id)
 			return
 		}
-		c.inbound <- message
+		select {
+		case c.inbound <- message:
+		case <-c.done:
+			return
+		}
 	}
 }
 
 func (c *Client) writeMessages() {
 	ticker := time.NewTicker(pingInterval)
+	var expired <-chan time.Time
+	if !c.expiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(c.expiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var (
+		flushTicker *time.Ticker
+		flush       <-chan time.Time
+	)
 	defer func() {
 		ticker.Stop()
+		if flushTicker != nil {
+			flushTicker.Stop()
+		}
 		c.close()
 	}()
 
 	for {
 		select {
+		case <-expired:
+			slog.Info("Closing expired connection", "client_id", c.id)
+			c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"))
+			return
 		case event, ok := <-c.outbound:
 
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
@@ -81,6 +190,24 @@ func (c *Client) writeMessages() {
 			if err := c.conn.WriteMessage(websocket.TextMessage, event); err != nil {
 				return
 			}
+		case <-c.rate:
+			if flushTicker != nil {
+				flushTicker.Stop()
+				flushTicker, flush = nil, nil
+			}
+			c.mu.Lock()
+			interval := c.interval
+			c.mu.Unlock()
+			if interval > 0 {
+				flushTicker = time.NewTicker(interval)
+				flush = flushTicker.C
+			} else if !c.flushPending() {
+				return
+			}
+		case <-flush:
+			if !c.flushPending() {
+				return
+			}
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(pingInterval))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -90,11 +217,34 @@ func (c *Client) writeMessages() {
 	}
 }
 
+// flushPending writes the updates held back by the rate limit. It reports
+// false if the connection failed.
+func (c *Client) flushPending() bool {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[uuid.UUID][]byte, len(pending))
+	c.mu.Unlock()
+
+	for _, frame := range pending {
+		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// close is safe to call from any goroutine. The reader closes inbound
+// itself on the way out, since it is the only sender.
 func (c *Client) close() {
 	c.closeOnce.Do(func() {
+		// Unregister first so the manager stops sending to outbound.
+		c.manager.removeClient(c)
+		c.mu.Lock()
+		c.closed = true
 		close(c.outbound)
-		close(c.inbound)
+		c.mu.Unlock()
+		close(c.done)
 		_ = c.conn.Close()
-		c.manager.removeClient(c.id)
 	})
 }
@@ -0,0 +1,200 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Frame types. The server answers every command with an ack carrying the
+// command id and any result, or with an error, and pushes topic updates
+// with a frame id. Clients confirm updates by sending an ack with that id;
+// acks are not answered.
+const (
+	FrameAck    = "ack"
+	FrameError  = "error"
+	FrameUpdate = "update"
+)
+
+// Error codes sent in error frames.
+const (
+	CodeBadRequest     = "bad_request"
+	CodeUnknownCommand = "unknown_command"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeBusy           = "busy"
+	CodeInternal       = "internal"
+)
+
+// clientQueueSize bounds the commands a client may have waiting; more are
+// rejected with CodeBusy instead of holding up other clients.
+const clientQueueSize = 16
+
+// Envelope is a frame of the command protocol in either direction. ID is
+// chosen by the client and echoed in the reply so it can match them up.
+type Envelope struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Topic uuid.UUID       `json:"topic,omitzero"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *CommandError   `json:"error,omitempty"`
+}
+
+// CommandError is returned by handlers to reject a command with a code the
+// client can act on. Any other error is reported as internal.
+type CommandError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func NewCommandError(code, message string) *CommandError {
+	return &CommandError{Code: code, Message: message}
+}
+
+// CommandHandler runs one command. The result, if not nil, is sent as the
+// data of the ack.
+type CommandHandler func(ctx context.Context, c *Client, data json.RawMessage) (any, error)
+
+// Dispatcher consumes Manager.ReadChannel and routes each envelope to the
+// handler registered for its type. Each client gets its own queue and
+// goroutine, so commands of one client run in order while a slow command
+// never delays another client.
+type Dispatcher struct {
+	handlers map[string]CommandHandler
+
+	mu     sync.Mutex
+	queues map[*Client]chan ReadFromWs
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[string]CommandHandler),
+		queues:   make(map[*Client]chan ReadFromWs),
+	}
+}
+
+func (d *Dispatcher) Handle(command string, handler CommandHandler) {
+	d.handlers[command] = handler
+}
+
+// Run dispatches messages until in is closed or ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, in <-chan ReadFromWs) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-in:
+			if !ok {
+				return
+			}
+			d.enqueue(ctx, msg)
+		}
+	}
+}
+
+// enqueue hands msg to its client's worker, starting one if needed.
+func (d *Dispatcher) enqueue(ctx context.Context, msg ReadFromWs) {
+	if msg.Client == nil {
+		return
+	}
+	d.mu.Lock()
+	queue, ok := d.queues[msg.Client]
+	if !ok {
+		queue = make(chan ReadFromWs, clientQueueSize)
+		d.queues[msg.Client] = queue
+		go d.serve(ctx, msg.Client, queue)
+	}
+	d.mu.Unlock()
+
+	select {
+	case queue <- msg:
+	default:
+		var env Envelope
+		_ = json.Unmarshal(msg.Payload, &env)
+		reply(msg.Client, Envelope{Type: FrameError, ID: env.ID, Error: NewCommandError(CodeBusy, "too many pending commands")})
+	}
+}
+
+// serve runs one client's commands in order until the client disconnects.
+func (d *Dispatcher) serve(ctx context.Context, c *Client, queue chan ReadFromWs) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.queues, c)
+		d.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case msg := <-queue:
+			d.Dispatch(ctx, msg)
+		}
+	}
+}
+
+func (d *Dispatcher) Dispatch(ctx context.Context, msg ReadFromWs) {
+	if msg.Client == nil {
+		return
+	}
+	var env Envelope
+	if err := json.Unmarshal(msg.Payload, &env); err != nil {
+		reply(msg.Client, Envelope{Type: FrameError, Error: NewCommandError(CodeBadRequest, "invalid json")})
+		return
+	}
+	if env.Type == FrameAck {
+		msg.Client.acknowledge(env.ID)
+		return
+	}
+	handler, ok := d.handlers[env.Type]
+	if !ok {
+		reply(msg.Client, Envelope{Type: FrameError, ID: env.ID, Error: NewCommandError(CodeUnknownCommand, "unknown command "+env.Type)})
+		return
+	}
+
+	result, err := handler(ctx, msg.Client, env.Data)
+	if err != nil {
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			slog.Warn("WebSocket command failed", "client_id", msg.Client.id, "type", env.Type, "error", err)
+			cmdErr = NewCommandError(CodeInternal, "command failed")
+		}
+		reply(msg.Client, Envelope{Type: FrameError, ID: env.ID, Error: cmdErr})
+		return
+	}
+	ack := Envelope{Type: FrameAck, ID: env.ID}
+	if result != nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			reply(msg.Client, Envelope{Type: FrameError, ID: env.ID, Error: NewCommandError(CodeInternal, "command failed")})
+			return
+		}
+		ack.Data = raw
+	}
+	reply(msg.Client, ack)
+}
+
+func reply(c *Client, env Envelope) {
+	raw, err := json.Marshal(env)
+	if err != nil {
+		slog.Warn("Failed to encode reply", "client_id", c.id, "error", err)
+		return
+	}
+	if !c.Send(raw) {
+		slog.Warn("Dropped reply to client", "client_id", c.id, "type", env.Type)
+	}
+}
+
+// updateFrame wraps a topic update in an envelope. The payload must be JSON.
+func updateFrame(id string, message WriteToWs) ([]byte, error) {
+	return json.Marshal(Envelope{Type: FrameUpdate, ID: id, Topic: message.ConsumerID, Data: message.Payload})
+}
@@ -4,53 +4,172 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// BearerProtocol is the subprotocol browsers offer together with their
+// token, as in new WebSocket(url, ["bearer", token]), since they cannot set
+// an Authorization header on the upgrade request.
+const BearerProtocol = "bearer"
+
+// readBuffer lets client readers hand over messages while the dispatcher
+// is busy starting a worker.
+const readBuffer = 64
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
+	Subprotocols:    []string{BearerProtocol},
+}
+
+type ServeOption func(*Client)
+
+// WithPrincipal attaches whatever authorized the connection, e.g. token
+// claims, so command handlers can authorize later requests.
+func WithPrincipal(principal any) ServeOption {
+	return func(c *Client) {
+		c.principal = principal
+	}
+}
+
+// WithExpiry closes the connection at t, e.g. when the token that
+// authorized it expires.
+func WithExpiry(t time.Time) ServeOption {
+	return func(c *Client) {
+		c.expiresAt = t
+	}
+}
+
+// Broker fans messages out across replicas. The manager publishes every
+// write to the broker instead of delivering it locally, subscribes to a
+// topic while it has at least one client for it, and delivers whatever the
+// broker receives to its local clients.
+type Broker interface {
+	Publish(ctx context.Context, message WriteToWs) error
+	Subscribe(ctx context.Context, topic uuid.UUID) error
+	Unsubscribe(ctx context.Context, topic uuid.UUID) error
+	Listen(ctx context.Context, deliver func(WriteToWs))
 }
 
 type Manager struct {
 	ctx          context.Context
-	clients      map[uuid.UUID]*Client
+	clients      map[uuid.UUID]ClientList
+	broker       Broker
+	subMu        sync.Mutex
 	read         chan ReadFromWs
 	write        chan WriteToWs
 	cancel       context.CancelFunc
 	wg           sync.WaitGroup
 	shutdownOnce sync.Once
 	mu           sync.Mutex
+	// frameSeq numbers update frames; it is guarded by mu.
+	frameSeq uint64
 }
 
 func NewManager() *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
-		clients: make(map[uuid.UUID]*Client),
+		clients: make(map[uuid.UUID]ClientList),
 		wg:      sync.WaitGroup{},
-		read:    make(chan ReadFromWs),
+		read:    make(chan ReadFromWs, readBuffer),
 		ctx:     ctx,
 		cancel:  cancel,
 	}
 }
 
+// WithBroker enables cluster delivery. It must be called before StartWrite.
+func (m *Manager) WithBroker(broker Broker) {
+	m.broker = broker
+}
+
+// addClient registers c under the topic it connected for.
 func (m *Manager) addClient(c *Client) {
+	m.Subscribe(c, c.id)
+}
+
+// Subscribe adds topic to the topics c receives updates for and subscribes
+// the broker when c is the first local client for it. subMu keeps subscribe
+// and unsubscribe calls in the same order as the refcount changes.
+func (m *Manager) Subscribe(c *Client, topic uuid.UUID) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.clients[c.id] = c
+	if c.topics[topic] {
+		m.mu.Unlock()
+		return
+	}
+	list, ok := m.clients[topic]
+	if !ok {
+		list = make(ClientList)
+		m.clients[topic] = list
+	}
+	list[c] = true
+	c.topics[topic] = true
+	first := len(list) == 1
+	m.mu.Unlock()
+
+	if first && m.broker != nil {
+		if err := m.broker.Subscribe(m.ctx, topic); err != nil {
+			slog.Warn("Broker subscribe failed", "topic", topic, "error", err)
+		}
+	}
+}
+
+// Unsubscribe stops updates for topic and reports whether c had it.
+func (m *Manager) Unsubscribe(c *Client, topic uuid.UUID) bool {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	return m.unsubscribe(c, topic)
 }
 
-func (m *Manager) removeClient(c uuid.UUID) {
+// unsubscribe must be called with subMu held.
+func (m *Manager) unsubscribe(c *Client, topic uuid.UUID) bool {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.clients, c)
+	if !c.topics[topic] {
+		m.mu.Unlock()
+		return false
+	}
+	delete(c.topics, topic)
+	list := m.clients[topic]
+	delete(list, c)
+	last := len(list) == 0
+	if last {
+		delete(m.clients, topic)
+	}
+	m.mu.Unlock()
+
+	if last && m.broker != nil {
+		if err := m.broker.Unsubscribe(context.Background(), topic); err != nil {
+			slog.Warn("Broker unsubscribe failed", "topic", topic, "error", err)
+		}
+	}
+	return true
 }
 
-func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+// removeClient drops every subscription of c.
+func (m *Manager) removeClient(c *Client) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	m.mu.Lock()
+	topics := make([]uuid.UUID, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	m.mu.Unlock()
+	for _, topic := range topics {
+		m.unsubscribe(c, topic)
+	}
+}
+
+func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, id uuid.UUID, opts ...ServeOption) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Warn("WebSocket upgrade failed", "client_id", id.String(), "error", err)
@@ -60,6 +179,9 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, id uuid.UUID)
 	slog.Info("WebSocket connection established", "client_id", id.String())
 
 	client := NewClient(id, conn, m)
+	for _, opt := range opts {
+		opt(client)
+	}
 	m.addClient(client)
 	m.wg.Add(3)
 	go func() {
@@ -73,9 +195,9 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, id uuid.UUID)
 	go func() {
 		defer m.wg.Done()
 		for message := range client.inbound {
-			m.read <- ReadFromWs{
-				Payload:    message,
-				ProducerID: client.id,
+			select {
+			case m.read <- ReadFromWs{Payload: message, ProducerID: client.id, Client: client}:
+			case <-client.done:
 			}
 		}
 	}()
@@ -89,6 +211,8 @@ type WriteToWs struct {
 type ReadFromWs struct {
 	Payload    []byte
 	ProducerID uuid.UUID
+	// Client sent the message and receives any reply.
+	Client *Client
 }
 
 func (m *Manager) StartWrite(ctx context.Context) {
@@ -111,22 +235,47 @@ func (m *Manager) StartWrite(ctx context.Context) {
 				if !ok {
 					return
 				}
-				m.mu.Lock()
-				client, exists := m.clients[message.ConsumerID]
-				m.mu.Unlock()
-
-				if exists {
-					select {
-					case client.outbound <- message.Payload:
-					default:
-						slog.Warn("Client outbound channel full", "client_id", message.ConsumerID)
-					}
-				} else {
-					slog.Warn("Client not found for message", "client_id", message.ConsumerID, "message", string(message.Payload))
+				if m.broker == nil {
+					m.deliver(message)
+					continue
+				}
+				if err := m.broker.Publish(m.ctx, message); err != nil {
+					slog.Warn("Broker publish failed", "topic", message.ConsumerID, "error", err)
 				}
 			}
 		}
 	}()
+
+	if m.broker != nil {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.broker.Listen(m.ctx, m.deliver)
+		}()
+	}
+}
+
+// deliver hands message to every local client of its topic, wrapped in an
+// update envelope. Frame ids increase per manager so clients can ack them.
+func (m *Manager) deliver(message WriteToWs) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, exists := m.clients[message.ConsumerID]
+	if !exists {
+		if m.broker == nil {
+			slog.Warn("Client not found for message", "client_id", message.ConsumerID, "message", string(message.Payload))
+		}
+		return
+	}
+	m.frameSeq++
+	frame, err := updateFrame(strconv.FormatUint(m.frameSeq, 10), message)
+	if err != nil {
+		slog.Warn("Failed to wrap update", "topic", message.ConsumerID, "error", err)
+		return
+	}
+	for client := range list {
+		client.update(message.ConsumerID, frame)
+	}
 }
 
 func (m *Manager) ReadChannel() <-chan ReadFromWs {
@@ -143,7 +292,15 @@ func (m *Manager) Shutdown() {
 			m.cancel()
 		}
 
-		for _, client := range m.clients {
+		m.mu.Lock()
+		var clients []*Client
+		for _, list := range m.clients {
+			for client := range list {
+				clients = append(clients, client)
+			}
+		}
+		m.mu.Unlock()
+		for _, client := range clients {
 			client.close()
 		}
 
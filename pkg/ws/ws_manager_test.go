@@ -0,0 +1,284 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type fakeBroker struct {
+	mu        sync.Mutex
+	subs      map[uuid.UUID]int
+	published chan WriteToWs
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{subs: make(map[uuid.UUID]int), published: make(chan WriteToWs, 16)}
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, message WriteToWs) error {
+	b.published <- message
+	return nil
+}
+
+func (b *fakeBroker) Subscribe(ctx context.Context, topic uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[topic]++
+	return nil
+}
+
+func (b *fakeBroker) Unsubscribe(ctx context.Context, topic uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[topic]--
+	return nil
+}
+
+// Listen loops published messages back, like a broker with a single replica.
+func (b *fakeBroker) Listen(ctx context.Context, deliver func(WriteToWs)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-b.published:
+			deliver(msg)
+		}
+	}
+}
+
+func (b *fakeBroker) subscriptions(topic uuid.UUID) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subs[topic]
+}
+
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerBrokerRefcountAndFanOut(t *testing.T) {
+	topic := uuid.New()
+	broker := newFakeBroker()
+	write := make(chan WriteToWs)
+
+	m := NewManager()
+	m.WithBroker(broker)
+	m.WithWriteChannel(write)
+	m.StartWrite(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeWS(w, r, topic)
+	}))
+	defer server.Close()
+
+	first := dial(t, server)
+	second := dial(t, server)
+	waitFor(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.clients[topic]) == 2
+	})
+	if got := broker.subscriptions(topic); got != 1 {
+		t.Fatalf("expected one subscription for two clients, got %d", got)
+	}
+
+	write <- WriteToWs{Payload: []byte(`"hello"`), ConsumerID: topic}
+	for _, conn := range []*websocket.Conn{first, second} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var env Envelope
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Type != FrameUpdate || env.Topic != topic || string(env.Data) != `"hello"` {
+			t.Fatalf("unexpected message %+v", env)
+		}
+	}
+
+	first.Close()
+	waitFor(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.clients[topic]) == 1
+	})
+	if got := broker.subscriptions(topic); got != 1 {
+		t.Fatalf("expected subscription kept while a client remains, got %d", got)
+	}
+
+	second.Close()
+	waitFor(t, func() bool { return broker.subscriptions(topic) == 0 })
+}
+
+func TestManagerClosesExpiredConnection(t *testing.T) {
+	m := NewManager()
+	m.WithWriteChannel(make(chan WriteToWs))
+	m.StartWrite(context.Background())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeWS(w, r, uuid.New(), WithExpiry(time.Now().Add(50*time.Millisecond)))
+	}))
+	defer server.Close()
+
+	conn := dial(t, server)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+}
+
+func readEnvelope(t *testing.T, c *Client) Envelope {
+	t.Helper()
+	select {
+	case frame := <-c.outbound:
+		var env Envelope
+		if err := json.Unmarshal(frame, &env); err != nil {
+			t.Fatalf("frame %q: %v", frame, err)
+		}
+		return env
+	case <-time.After(time.Second):
+		t.Fatal("no frame sent")
+		return Envelope{}
+	}
+}
+
+func TestDispatcherRepliesAndErrors(t *testing.T) {
+	m := NewManager()
+	client := NewClient(uuid.New(), nil, m)
+
+	d := NewDispatcher()
+	d.Handle("echo", func(_ context.Context, _ *Client, data json.RawMessage) (any, error) {
+		return data, nil
+	})
+	d.Handle("deny", func(context.Context, *Client, json.RawMessage) (any, error) {
+		return nil, NewCommandError(CodeForbidden, "no")
+	})
+	d.Handle("fail", func(context.Context, *Client, json.RawMessage) (any, error) {
+		return nil, errors.New("database down")
+	})
+
+	tests := []struct {
+		payload string
+		want    Envelope
+	}{
+		{`{"type":"echo","id":"1","data":{"x":1}}`, Envelope{Type: FrameAck, ID: "1", Data: json.RawMessage(`{"x":1}`)}},
+		{`{"type":"deny","id":"2"}`, Envelope{Type: FrameError, ID: "2", Error: &CommandError{Code: CodeForbidden, Message: "no"}}},
+		{`{"type":"fail","id":"3"}`, Envelope{Type: FrameError, ID: "3", Error: &CommandError{Code: CodeInternal, Message: "command failed"}}},
+		{`{"type":"nope","id":"4"}`, Envelope{Type: FrameError, ID: "4", Error: &CommandError{Code: CodeUnknownCommand, Message: "unknown command nope"}}},
+		{`not json`, Envelope{Type: FrameError, Error: &CommandError{Code: CodeBadRequest, Message: "invalid json"}}},
+	}
+	for _, tt := range tests {
+		d.Dispatch(context.Background(), ReadFromWs{Payload: []byte(tt.payload), Client: client})
+		got := readEnvelope(t, client)
+		if got.Type != tt.want.Type || got.ID != tt.want.ID || string(got.Data) != string(tt.want.Data) {
+			t.Fatalf("%s: got %+v, want %+v", tt.payload, got, tt.want)
+		}
+		if (got.Error == nil) != (tt.want.Error == nil) || (got.Error != nil && *got.Error != *tt.want.Error) {
+			t.Fatalf("%s: error %+v, want %+v", tt.payload, got.Error, tt.want.Error)
+		}
+	}
+}
+
+func TestTopicsAreEnvelopedAndRateLimited(t *testing.T) {
+	m := NewManager()
+	home, other := uuid.New(), uuid.New()
+	client := NewClient(home, nil, m)
+	m.addClient(client)
+	m.Subscribe(client, other)
+
+	m.deliver(WriteToWs{Payload: []byte(`{"n":1}`), ConsumerID: home})
+	first := readEnvelope(t, client)
+	if first.Type != FrameUpdate || first.Topic != home || first.ID == "" || string(first.Data) != `{"n":1}` {
+		t.Fatalf("home topic frame = %+v", first)
+	}
+	m.deliver(WriteToWs{Payload: []byte(`{"n":2}`), ConsumerID: other})
+	second := readEnvelope(t, client)
+	if second.Type != FrameUpdate || second.Topic != other || string(second.Data) != `{"n":2}` {
+		t.Fatalf("subscribed topic frame = %+v", second)
+	}
+	if second.ID == first.ID {
+		t.Fatalf("update frames share id %q", first.ID)
+	}
+
+	client.SetInterval(time.Second)
+	m.deliver(WriteToWs{Payload: []byte(`{"n":3}`), ConsumerID: home})
+	m.deliver(WriteToWs{Payload: []byte(`{"n":4}`), ConsumerID: home})
+	var pending Envelope
+	if err := json.Unmarshal(client.pending[home], &pending); err != nil || len(client.outbound) != 0 || string(pending.Data) != `{"n":4}` {
+		t.Fatalf("rate limit kept %q, queued %d", client.pending[home], len(client.outbound))
+	}
+
+	if !m.Unsubscribe(client, other) || m.Unsubscribe(client, other) {
+		t.Fatal("Unsubscribe should report the subscription once")
+	}
+	m.mu.Lock()
+	_, stillListed := m.clients[other]
+	m.mu.Unlock()
+	if stillListed {
+		t.Fatal("topic kept after its last client left")
+	}
+}
+
+func TestDispatcherAcksAreRecordedWithoutReply(t *testing.T) {
+	client := NewClient(uuid.New(), nil, NewManager())
+	NewDispatcher().Dispatch(context.Background(), ReadFromWs{Payload: []byte(`{"type":"ack","id":"42"}`), Client: client})
+	if got := client.LastAck(); got != "42" {
+		t.Fatalf("LastAck = %q, want 42", got)
+	}
+	if len(client.outbound) != 0 {
+		t.Fatalf("ack was answered")
+	}
+}
+
+func TestDispatcherRunsClientsIndependently(t *testing.T) {
+	m := NewManager()
+	slow, fast := NewClient(uuid.New(), nil, m), NewClient(uuid.New(), nil, m)
+	release := make(chan struct{})
+	defer close(release)
+
+	d := NewDispatcher()
+	d.Handle("block", func(context.Context, *Client, json.RawMessage) (any, error) {
+		<-release
+		return nil, nil
+	})
+	d.Handle("ping", func(context.Context, *Client, json.RawMessage) (any, error) {
+		return nil, nil
+	})
+
+	in := make(chan ReadFromWs)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, in)
+
+	in <- ReadFromWs{Payload: []byte(`{"type":"block","id":"1"}`), Client: slow}
+	in <- ReadFromWs{Payload: []byte(`{"type":"ping","id":"2"}`), Client: fast}
+	if env := readEnvelope(t, fast); env.Type != FrameAck || env.ID != "2" {
+		t.Fatalf("fast client got %+v", env)
+	}
+}